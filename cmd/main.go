@@ -2,45 +2,228 @@ package main
 
 import (
 	"context"
-	"github.com/shushard/ChatBot/internal"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"sort"
 
 	"github.com/rs/zerolog"
+	"github.com/shushard/ChatBot/internal"
 	"github.com/shushard/ChatBot/internal/config"
 )
 
+const defaultFixturesDir = "internal/testdata/fixtures"
+
+// command is a CLI subcommand. Every command gets the common -config and
+// -log-level flags; flags adds its own.
+type command struct {
+	usage string
+	flags func(fs *flag.FlagSet)
+	run   func(ctx context.Context, env *environment, fs *flag.FlagSet) error
+}
+
+// environment is what the common flags produce.
+type environment struct {
+	conf   config.Config
+	logger zerolog.Logger
+}
+
+var commands = map[string]command{
+	"run": {
+		usage: "watch the configured channels and reply",
+		flags: func(fs *flag.FlagSet) {
+			fs.Bool("dry-run", false, "compose replies but only log them (overrides dryRun in config)")
+		},
+		run: runService,
+	},
+	"login": {
+		usage: "log in by hand and save the browser session",
+		run:   runLogin,
+	},
+	"doctor": {
+		usage: "check site selectors against the live page",
+		run:   runDoctor,
+	},
+	"chat": {
+		usage: "talk to the persona in the terminal, no browser",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("persona", "", "persona to talk to (default: the built-in persona)")
+		},
+		run: runChat,
+	},
+	"replay": {
+		usage: "re-run logged conversations through the pipeline",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("log", "", "conversation log to replay (default: conversations.jsonl in savePath)")
+		},
+		run: runReplay,
+	},
+	"check-config": {
+		usage: "load and validate the config",
+		run:   runCheckConfig,
+	},
+	"index": {
+		usage: "rebuild the knowledge base index from the markdown docs",
+		run:   runIndex,
+	},
+	"fixtures": {
+		usage: "check message-list fixtures against golden files",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("dir", defaultFixturesDir, "fixtures directory")
+			fs.Bool("update", false, "rewrite golden files")
+		},
+		run: runFixtures,
+	},
+}
+
 func main() {
 	// Initialize logger
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
 
-	// Load or define your configuration
-	conf := config.Config{
-		SavePath: "videos", // Adjust the save path as needed
-		Headless: false,    // Set to true if you want to run in headless mode
-		SiteConfigs: []config.SiteConfig{
-			{
-				SiteURL: "https://discord.com/",
-				// Add other site-specific configurations if needed
-			},
-		},
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage()
+		os.Exit(2)
 	}
 
-	// Create the Service
-	service, err := internal.New(conf, &logger)
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := fs.String("config", "", "path to TOML config (default: built-in config)")
+	logLevel := fs.String("log-level", "info", "log level: debug, info, warn, error")
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	_ = fs.Parse(os.Args[2:])
+
+	level, err := zerolog.ParseLevel(*logLevel)
+	if err != nil {
+		logger.Error().Err(err).Msg("Invalid log level")
+		os.Exit(2)
+	}
+	logger = logger.Level(level)
+
+	// Load or define your configuration
+	conf, err := config.Load(*configPath)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to create service")
+		logger.Error().Err(err).Msg("Failed to load config")
 		os.Exit(1)
 	}
 
-	// Run the Service
-	ctx := context.Background()
-	if err := service.Run(ctx); err != nil {
-		logger.Error().Err(err).Msg("Service run failed")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := cmd.run(ctx, &environment{conf: conf, logger: logger}, fs); err != nil {
+		logger.Error().Err(err).Str("command", name).Msg("Command failed")
+		stop()
 		os.Exit(1)
 	}
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [-config path] [-log-level level] [flags]\n\ncommands:\n", os.Args[0])
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].usage)
+	}
+}
+
+// newService validates the config and creates the Service.
+func newService(env *environment) (*internal.Service, error) {
+	if err := env.conf.Validate(); err != nil {
+		return nil, fmt.Errorf("config not valid: %w", err)
+	}
+
+	service, err := internal.New(env.conf, &env.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service: %w", err)
+	}
+	return service, nil
+}
+
+func runService(ctx context.Context, env *environment, fs *flag.FlagSet) error {
+	if fs.Lookup("dry-run").Value.String() == "true" {
+		env.conf.DryRun = true
+	}
+
+	service, err := newService(env)
+	if err != nil {
+		return err
+	}
+
+	// Run the Service
+	if err := service.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("service run failed: %w", err)
+	}
 
-	// Optionally, shutdown the service when done
 	if err := service.Shutdown(ctx); err != nil {
-		logger.Error().Err(err).Msg("Service shutdown failed")
+		return fmt.Errorf("service shutdown failed: %w", err)
+	}
+	return nil
+}
+
+func runLogin(ctx context.Context, env *environment, _ *flag.FlagSet) error {
+	service, err := newService(env)
+	if err != nil {
+		return err
+	}
+	return service.Login(ctx)
+}
+
+func runDoctor(ctx context.Context, env *environment, _ *flag.FlagSet) error {
+	service, err := newService(env)
+	if err != nil {
+		return err
 	}
+	return service.Doctor(ctx, os.Stdout)
+}
+
+func runChat(ctx context.Context, env *environment, fs *flag.FlagSet) error {
+	service, err := newService(env)
+	if err != nil {
+		return err
+	}
+	if err := service.UsePersona(fs.Lookup("persona").Value.String()); err != nil {
+		return err
+	}
+	return service.Chat(ctx, os.Stdin, os.Stdout)
+}
+
+func runReplay(ctx context.Context, env *environment, fs *flag.FlagSet) error {
+	service, err := newService(env)
+	if err != nil {
+		return err
+	}
+	return service.Replay(ctx, fs.Lookup("log").Value.String(), os.Stdout)
+}
+
+func runCheckConfig(_ context.Context, env *environment, _ *flag.FlagSet) error {
+	if err := env.conf.Validate(); err != nil {
+		return fmt.Errorf("config not valid: %w", err)
+	}
+	fmt.Println("config OK")
+	return nil
+}
+
+func runIndex(_ context.Context, env *environment, _ *flag.FlagSet) error {
+	if err := env.conf.Validate(); err != nil {
+		return fmt.Errorf("config not valid: %w", err)
+	}
+	return internal.BuildKnowledgeIndex(env.conf, os.Stdout)
+}
+
+func runFixtures(ctx context.Context, env *environment, fs *flag.FlagSet) error {
+	update := fs.Lookup("update").Value.String() == "true"
+	return internal.CheckFixtures(ctx, &env.logger, fs.Lookup("dir").Value.String(), update, os.Stdout)
 }
@@ -3,6 +3,9 @@ module github.com/shushard/ChatBot
 go 1.23.1
 
 require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/pkoukk/tiktoken-go v0.1.8
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
 	github.com/playwright-community/playwright-go v0.4702.0
 	github.com/rs/zerolog v1.33.0
 	github.com/sashabaranov/go-openai v1.31.0
@@ -10,8 +13,10 @@ require (
 
 require (
 	github.com/deckarep/golang-set/v2 v2.6.0 // indirect
+	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/go-jose/go-jose/v3 v3.0.3 // indirect
 	github.com/go-stack/stack v1.8.1 // indirect
+	github.com/google/uuid v1.3.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/stretchr/testify v1.9.0 // indirect
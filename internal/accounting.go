@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const (
+	spendFile = "spend.json"
+	usageFile = "usage.jsonl"
+	dayLayout = "2006-01-02"
+)
+
+var ErrBudgetExceeded = errors.New("LLM budget exceeded")
+
+// usageOrigin says who and what a completion was made for.
+type usageOrigin struct {
+	User string
+	// UserID is the stable user key, see chatMessage.userKey.
+	UserID  string
+	Channel string
+	// MessageID is the message being answered, if any.
+	MessageID string
+}
+
+// userKey is what spend is totalled by: the stable user key, or the name for
+// callers that have none.
+func (o usageOrigin) userKey() string {
+	if o.UserID != "" {
+		return o.UserID
+	}
+	return o.User
+}
+
+// usageTotals are summed tokens and cost.
+type usageTotals struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (t *usageTotals) add(usage tokenUsage, cost float64) {
+	t.Calls++
+	t.PromptTokens += usage.PromptTokens
+	t.CompletionTokens += usage.CompletionTokens
+	t.Cost += cost
+}
+
+// daySpend is the spend of one day, overall and broken down.
+type daySpend struct {
+	usageTotals
+	// ByUser is keyed by usageOrigin.userKey, so renames don't split a user.
+	ByUser    map[string]*usageTotals `json:"byUser"`
+	ByChannel map[string]*usageTotals `json:"byChannel"`
+	ByModel   map[string]*usageTotals `json:"byModel"`
+}
+
+// usageRecord is one line of the per-call usage log.
+type usageRecord struct {
+	Time             time.Time `json:"time"`
+	Model            string    `json:"model"`
+	User             string    `json:"user,omitempty"`
+	UserID           string    `json:"userId,omitempty"`
+	Channel          string    `json:"channel,omitempty"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	Cost             float64   `json:"cost"`
+}
+
+// spendLedger accounts LLM usage and enforces the budget. Daily totals are
+// persisted under SavePath so budgets survive restarts.
+type spendLedger struct {
+	mu     sync.Mutex
+	dir    string
+	budget config.Budget
+	// unpriced models were already reported as missing from the price table.
+	unpriced map[string]bool
+	Days     map[string]*daySpend `json:"days"`
+}
+
+func loadSpendLedger(dir string, budget config.Budget) (*spendLedger, error) {
+	l := &spendLedger{
+		dir:      dir,
+		budget:   budget,
+		unpriced: make(map[string]bool),
+		Days:     make(map[string]*daySpend),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, spendFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read spend ledger: %w", err)
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("can't parse spend ledger: %w", err)
+	}
+
+	return l, nil
+}
+
+// model picks the model for the next call: the configured one while the
+// budget allows it, the fallback once a cap is reached, or ErrBudgetExceeded.
+func (l *spendLedger) model(preferred string, now time.Time) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	daily, monthly := l.spentLocked(now)
+	over := (l.budget.Daily > 0 && daily >= l.budget.Daily) ||
+		(l.budget.Monthly > 0 && monthly >= l.budget.Monthly)
+	if !over {
+		return preferred, nil
+	}
+	if l.budget.FallbackModel != "" {
+		return l.budget.FallbackModel, nil
+	}
+
+	return "", fmt.Errorf("%w: spent %.4f today, %.4f this month", ErrBudgetExceeded, daily, monthly)
+}
+
+// spent returns what was spent on the day and in the month of now.
+func (l *spendLedger) spent(now time.Time) (float64, float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.spentLocked(now)
+}
+
+func (l *spendLedger) spentLocked(now time.Time) (float64, float64) {
+	day := now.Format(dayLayout)
+	month := now.Format("2006-01")
+
+	var daily, monthly float64
+	for key, spend := range l.Days {
+		if key == day {
+			daily = spend.Cost
+		}
+		if strings.HasPrefix(key, month) {
+			monthly += spend.Cost
+		}
+	}
+
+	return daily, monthly
+}
+
+func (l *spendLedger) cost(model string, usage tokenUsage) (float64, bool) {
+	price, ok := l.budget.Prices[model]
+	if !ok {
+		return 0, false
+	}
+
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6, true
+}
+
+// record adds a call to the totals, appends it to the usage log and saves
+// the ledger. It returns the estimated cost of the call.
+func (l *spendLedger) record(model string, origin usageOrigin, usage tokenUsage, now time.Time) (float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cost, priced := l.cost(model, usage)
+
+	day := now.Format(dayLayout)
+	spend, ok := l.Days[day]
+	if !ok {
+		spend = &daySpend{
+			ByUser:    make(map[string]*usageTotals),
+			ByChannel: make(map[string]*usageTotals),
+			ByModel:   make(map[string]*usageTotals),
+		}
+		l.Days[day] = spend
+	}
+	spend.add(usage, cost)
+	addTotals(spend.ByUser, origin.userKey(), usage, cost)
+	addTotals(spend.ByChannel, origin.Channel, usage, cost)
+	addTotals(spend.ByModel, model, usage, cost)
+
+	var errs error
+	if !priced && !l.unpriced[model] {
+		l.unpriced[model] = true
+		errs = fmt.Errorf("no price for model %s, cost counted as 0", model)
+	}
+	if err := l.appendUsageLocked(usageRecord{
+		Time:             now,
+		Model:            model,
+		User:             origin.User,
+		UserID:           origin.UserID,
+		Channel:          origin.Channel,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             cost,
+	}); err != nil {
+		errs = errors.Join(errs, err)
+	}
+	if err := l.saveLocked(); err != nil {
+		errs = errors.Join(errs, err)
+	}
+
+	return cost, errs
+}
+
+func addTotals(totals map[string]*usageTotals, key string, usage tokenUsage, cost float64) {
+	if key == "" {
+		return
+	}
+	t, ok := totals[key]
+	if !ok {
+		t = &usageTotals{}
+		totals[key] = t
+	}
+	t.add(usage, cost)
+}
+
+func (l *spendLedger) appendUsageLocked(record usageRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("can't marshal usage record: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(l.dir, usageFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("can't open usage log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("can't write usage log: %w", err)
+	}
+
+	return nil
+}
+
+func (l *spendLedger) saveLocked() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal spend ledger: %w", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated ledger.
+	path := filepath.Join(l.dir, spendFile)
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("can't write spend ledger: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("can't replace spend ledger: %w", err)
+	}
+
+	return nil
+}
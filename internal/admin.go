@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// serveAdmin serves the admin API on addr until ctx is done. Every request
+// must carry the admin token as a bearer token.
+func (s *Service) serveAdmin(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/memory", s.handleListMemory)
+	mux.HandleFunc("GET /api/memory/{user}", s.handleGetMemory)
+	mux.HandleFunc("DELETE /api/memory/{user}", s.handleForgetUser)
+	mux.HandleFunc("DELETE /api/memory/{user}/{id}", s.handleForgetFact)
+
+	return s.serveHTTP(ctx, "admin", addr, s.requireAdminToken(mux))
+}
+
+func (s *Service) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Service) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to write admin response")
+	}
+}
+
+// memoryEnabled answers 404 when memory is off.
+func (s *Service) memoryEnabled(w http.ResponseWriter) bool {
+	if s.memory == nil {
+		http.Error(w, "memory is disabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+func (s *Service) handleListMemory(w http.ResponseWriter, _ *http.Request) {
+	if !s.memoryEnabled(w) {
+		return
+	}
+	s.writeJSON(w, s.memory.users())
+}
+
+func (s *Service) handleGetMemory(w http.ResponseWriter, r *http.Request) {
+	if !s.memoryEnabled(w) {
+		return
+	}
+	key, ok := s.memory.findUser(r.PathValue("user"))
+	if !ok {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	s.writeJSON(w, s.memory.facts(key))
+}
+
+func (s *Service) handleForgetUser(w http.ResponseWriter, r *http.Request) {
+	if !s.memoryEnabled(w) {
+		return
+	}
+	key, ok := s.memory.findUser(r.PathValue("user"))
+	if !ok {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if _, err := s.memory.forget(key); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) handleForgetFact(w http.ResponseWriter, r *http.Request) {
+	if !s.memoryEnabled(w) {
+		return
+	}
+	key, ok := s.memory.findUser(r.PathValue("user"))
+	if !ok {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	found, err := s.memory.forgetFact(key, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "fact not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const defaultPersonaName = config.DefaultPersonaName
+
+// persona is the system prompt and few-shot examples a channel is answered
+// with.
+type persona struct {
+	name     string
+	prompt   string
+	examples []config.Example
+	// dms is whether the persona answers direct messages.
+	dms bool
+}
+
+// persona returns the configured persona called name, or the built-in one
+// with the top-level examples when name is empty.
+func (s *Service) persona(name string) (persona, bool) {
+	if name == "" {
+		return persona{name: defaultPersonaName, prompt: systemPrompt, examples: s.config.Examples, dms: true}, true
+	}
+	for _, p := range s.config.Personas {
+		if p.Name == name {
+			return persona{name: p.Name, prompt: p.Prompt, examples: p.Examples, dms: p.DMs}, true
+		}
+	}
+	return persona{}, false
+}
+
+// UsePersona makes the persona called name answer the current channel.
+func (s *Service) UsePersona(name string) error {
+	p, ok := s.persona(name)
+	if !ok {
+		return fmt.Errorf("unknown persona %s", name)
+	}
+	s.channel.persona = p
+	return nil
+}
+
+// channelState is what the bot keeps per watched channel: its page, the
+// messages already seen there, the conversation, the persona answering it and
+// the rate limits it shares with channels of its kind. In dm channels every
+// message is for the bot.
+type channelState struct {
+	url                 string
+	page                playwright.Page
+	persona             persona
+	limiter             *replyLimiter
+	dm                  bool
+	seenMessages        map[string]bool
+	authors             map[string]messageAuthor
+	edits               *editTracker
+	conversationHistory []map[string]string
+	conversationSummary string
+	// lastActivity is when someone other than the bot last wrote.
+	lastActivity time.Time
+}
+
+func newChannelState(url string, page playwright.Page, p persona, limiter *replyLimiter) *channelState {
+	return &channelState{
+		url:          url,
+		page:         page,
+		persona:      p,
+		limiter:      limiter,
+		seenMessages: make(map[string]bool),
+		authors:      make(map[string]messageAuthor),
+		edits:        newEditTracker(),
+	}
+}
+
+// useChannel makes ch the channel the service reads from and answers in.
+func (s *Service) useChannel(ch *channelState) {
+	if s.channel == ch {
+		return
+	}
+	s.channel = ch
+	if s.page != nil && s.page != ch.page {
+		if err := ch.page.BringToFront(); err != nil {
+			s.logger.Warn().Err(err).Str("channel", ch.url).Msg("Failed to bring channel to front")
+		}
+	}
+	s.page = ch.page
+}
+
+// openChannels opens the configured channels of a site, the first one in
+// page and the others in new pages of the same browser context, so they share
+// the login. Without configured channels the current page is watched.
+func (s *Service) openChannels(page playwright.Page, siteConfig config.SiteConfig) error {
+	s.channels = nil
+	s.channel = nil
+
+	if len(siteConfig.Channels) == 0 {
+		p, _ := s.persona("")
+		ch := newChannelState(page.URL(), page, p, s.limiter)
+		s.restoreHistory(ch)
+		s.channels = append(s.channels, ch)
+		return nil
+	}
+
+	for i, channel := range siteConfig.Channels {
+		p, ok := s.persona(channel.Persona)
+		if !ok {
+			return fmt.Errorf("unknown persona %s", channel.Persona)
+		}
+
+		channelPage := page
+		if i > 0 {
+			var err error
+			if channelPage, err = page.Context().NewPage(); err != nil {
+				return fmt.Errorf("can't create page for %s: %w", channel.URL, err)
+			}
+		}
+		if _, err := channelPage.Goto(channel.URL, playwright.PageGotoOptions{
+			WaitUntil: playwright.WaitUntilStateNetworkidle,
+		}); err != nil {
+			return fmt.Errorf("can't go to channel %s: %w", channel.URL, err)
+		}
+
+		ch := newChannelState(channel.URL, channelPage, p, s.limiter)
+		s.restoreHistory(ch)
+		s.channels = append(s.channels, ch)
+		s.logger.Info().Str("channel", channel.URL).Str("persona", p.name).Msg("Watching channel")
+	}
+
+	return nil
+}
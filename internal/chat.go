@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	chatResetCommand = "/reset"
+	chatUser         = "local"
+	chatChannel      = "chat"
+)
+
+// Chat is a terminal conversation with the persona. Every line read from in
+// goes through the same reply pipeline as a chat message; the raw model
+// output, the filtered reply and the token usage are written to out. Facts are
+// not remembered, so trying prompts out never touches the saved memory.
+func (s *Service) Chat(ctx context.Context, in io.Reader, out io.Writer) error {
+	fmt.Fprintf(out, "Type a message, %s to clear history, empty line or Ctrl+D to quit.\n", chatResetCommand)
+
+	var total tokenUsage
+	var totalCost float64
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			break
+		}
+		if line == chatResetCommand {
+			s.channel.conversationHistory = s.channel.conversationHistory[:0]
+			s.channel.conversationSummary = ""
+			fmt.Fprintln(out, "history cleared")
+			continue
+		}
+
+		r, err := s.generateReply(line, nil, usageOrigin{User: chatUser, UserID: chatUser, Channel: chatChannel})
+		if err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+			continue
+		}
+
+		total.PromptTokens += r.Usage.PromptTokens
+		total.CompletionTokens += r.Usage.CompletionTokens
+		total.TotalTokens += r.Usage.TotalTokens
+
+		writeReply(out, r)
+		if s.config.StructuredOutput {
+			fmt.Fprintf(out, "decision: silent %t, reaction %q, reply to %q\n", r.Silent, r.Reaction, r.ReplyTo)
+		}
+		fmt.Fprintf(out, "prompt: ~%d tokens, %d history messages dropped, %d knowledge passages\n",
+			r.PromptTokens, r.DroppedHistory, r.Passages)
+		if r.Summarized {
+			fmt.Fprintf(out, "summary: %s\n", s.channel.conversationSummary)
+		}
+		totalCost += r.Cost
+		fmt.Fprintf(out, "%s tokens: prompt %d, completion %d, total %d (session %d), cost %.6f (session %.6f)\n\n",
+			r.Model, r.Usage.PromptTokens, r.Usage.CompletionTokens, r.Usage.TotalTokens, total.TotalTokens, r.Cost, totalCost)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("can't read input: %w", err)
+	}
+
+	return nil
+}
+
+// writeReply prints the raw model output and the filtered reply in two
+// columns, line by line.
+func writeReply(out io.Writer, r reply) {
+	raw := strings.Split(strings.TrimSpace(r.Raw), "\n")
+	filtered := strings.Split(r.Text, "\n")
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "raw\tfiltered")
+	for i := 0; i < len(raw) || i < len(filtered); i++ {
+		var left, right string
+		if i < len(raw) {
+			left = raw[i]
+		}
+		if i < len(filtered) {
+			right = filtered[i]
+		}
+		fmt.Fprintf(w, "%s\t%s\n", left, right)
+	}
+	w.Flush()
+}
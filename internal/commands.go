@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCommandPrefix = "!bot"
+	commandHelp          = "команды: pause, resume, persona <имя>, forget @ник, status"
+)
+
+// botCommand is a parsed "!bot <name> <args>" message.
+type botCommand struct {
+	name string
+	args []string
+}
+
+func (s *Service) commandPrefix() string {
+	if s.config.Commands.Prefix != "" {
+		return s.config.Commands.Prefix
+	}
+	return defaultCommandPrefix
+}
+
+// parseCommand reads a command from a message starting with prefix.
+func parseCommand(prefix, content string) (botCommand, bool) {
+	fields := strings.Fields(content)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], prefix) {
+		return botCommand{}, false
+	}
+	if len(fields) == 1 {
+		return botCommand{name: "help"}, true
+	}
+	return botCommand{name: strings.ToLower(fields[1]), args: fields[2:]}, true
+}
+
+// isOperator reports whether the author of msg may use commands. Numeric
+// operators are user IDs and only match the ID from the avatar; other
+// operators are names, matched only when names are allowed.
+func (s *Service) isOperator(msg chatMessage) bool {
+	for _, operator := range s.config.Commands.Operators {
+		operator = normalizeName(operator)
+		if isUserID(operator) {
+			if msg.AuthorID != "" && operator == msg.AuthorID {
+				return true
+			}
+			continue
+		}
+		if s.config.Commands.AllowNames && strings.EqualFold(operator, msg.Author) {
+			return true
+		}
+	}
+	return false
+}
+
+func isUserID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// runCommand executes a command from an operator and acknowledges it in the
+// channel. Commands from anyone else are ignored.
+func (s *Service) runCommand(msg chatMessage, cmd botCommand) {
+	if !s.isOperator(msg) {
+		countMetric("commands_denied")
+		s.logger.Warn().Str("id", msg.ID).Str("author", msg.Author).Str("command", cmd.name).Msg("Command from non-operator ignored")
+		return
+	}
+	countMetric("commands")
+	s.logger.Info().Str("author", msg.Author).Str("command", cmd.name).Strs("args", cmd.args).Msg("Running command")
+
+	ack := s.executeCommand(cmd)
+	if s.config.DryRun {
+		s.logger.Info().Str("id", msg.ID).Str("text", ack).Msg("Dry run: would acknowledge command")
+	} else if err := s.sendMessage(ack); err != nil {
+		s.logger.Error().Err(err).Str("command", cmd.name).Msg("Failed to acknowledge command")
+	} else {
+		s.triggers.botPosted(s.channel.url, time.Now())
+	}
+
+	s.logConversation(conversationEntry{
+		Time:      time.Now(),
+		Kind:      entryCommand,
+		Site:      s.channel.url,
+		MessageID: msg.ID,
+		Author:    msg.Author,
+		Input:     msg.Content,
+		Response:  ack,
+		DryRun:    s.config.DryRun,
+	})
+}
+
+// executeCommand applies cmd and returns the acknowledgement.
+func (s *Service) executeCommand(cmd botCommand) string {
+	switch cmd.name {
+	case "pause":
+		s.paused = true
+		return "на паузе, молчу"
+	case "resume":
+		s.paused = false
+		return "снова тут"
+	case "persona":
+		return s.switchPersona(cmd.args)
+	case "forget":
+		return s.forgetUser(strings.Join(cmd.args, " "))
+	case "status":
+		return s.status()
+	default:
+		return commandHelp
+	}
+}
+
+// switchPersona changes the persona of the current channel. In a DM it
+// changes the persona of all DMs, which stop being answered when the new
+// persona has DMs switched off.
+func (s *Service) switchPersona(args []string) string {
+	if len(args) == 0 {
+		return "персона: " + s.channel.persona.name
+	}
+	name := args[0]
+	if name == defaultPersonaName {
+		name = ""
+	}
+	p, ok := s.persona(name)
+	if !ok {
+		return "нет такой персоны: " + args[0]
+	}
+
+	s.channel.persona = p
+	if s.channel.dm && s.dms != nil {
+		s.dms.persona = p
+		for _, ch := range s.dms.channels {
+			ch.persona = p
+		}
+		if !p.dms {
+			return fmt.Sprintf("теперь я %s, в личке молчу", p.name)
+		}
+	}
+	return "теперь я " + p.name
+}
+
+func (s *Service) forgetUser(name string) string {
+	if s.memory == nil {
+		return "память выключена"
+	}
+	if name == "" {
+		return "кого забыть?"
+	}
+	key, ok := s.memory.findUser(name)
+	if !ok {
+		return "про " + name + " ничего не помню"
+	}
+	if _, err := s.memory.forget(key); err != nil {
+		s.logger.Error().Err(err).Str("user", key).Msg("Failed to forget user")
+		return "не получилось забыть " + name
+	}
+	return "забыто всё про " + name
+}
+
+func (s *Service) status() string {
+	state := "работаю"
+	if s.paused {
+		state = "на паузе"
+	}
+	dms := "выкл"
+	if s.dms != nil && s.dms.persona.dms {
+		dms = "вкл"
+	}
+	daily, monthly := s.ledger.spent(time.Now())
+
+	return fmt.Sprintf("%s, персона %s, каналов %d, личка %s, потрачено %.2f за день и %.2f за месяц",
+		state, s.channel.persona.name, len(s.channels), dms, daily, monthly)
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		content string
+		ok      bool
+		want    botCommand
+	}{
+		{"!bot pause", true, botCommand{name: "pause"}},
+		{"  !BOT  Persona   grumpy ", true, botCommand{name: "persona", args: []string{"grumpy"}}},
+		{"!bot", true, botCommand{name: "help"}},
+		{"!bots pause", false, botCommand{}},
+		{"hey !bot pause", false, botCommand{}},
+		{"", false, botCommand{}},
+	}
+	for _, tt := range tests {
+		got, ok := parseCommand(defaultCommandPrefix, tt.content)
+		if ok != tt.ok || got.name != tt.want.name || !slices.Equal(got.args, tt.want.args) {
+			t.Errorf("parseCommand(%q) = %+v, %t, want %+v, %t", tt.content, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIsOperator(t *testing.T) {
+	const id = "111222333444555666"
+	tests := []struct {
+		name       string
+		operators  []string
+		allowNames bool
+		msg        chatMessage
+		want       bool
+	}{
+		{"id matches author ID", []string{id}, false, chatMessage{Author: "bob", AuthorID: id}, true},
+		{"id with @ matches author ID", []string{"@" + id}, false, chatMessage{Author: "bob", AuthorID: id}, true},
+		{"id does not match other ID", []string{id}, false, chatMessage{Author: "bob", AuthorID: "999"}, false},
+		{"id does not match empty author ID", []string{id}, true, chatMessage{Author: "bob"}, false},
+		{"id does not match name", []string{id}, true, chatMessage{Author: id}, false},
+		{"name ignored without allowNames", []string{"bob"}, false, chatMessage{Author: "bob", AuthorID: id}, false},
+		{"name matches with allowNames", []string{"Bob"}, true, chatMessage{Author: "bob"}, true},
+		{"name does not match other name", []string{"bob"}, true, chatMessage{Author: "bobby"}, false},
+		{"no operators", nil, true, chatMessage{Author: "bob", AuthorID: id}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{config: &config.Config{Commands: config.Commands{
+				Operators:  tt.operators,
+				AllowNames: tt.allowNames,
+			}}}
+			if got := s.isOperator(tt.msg); got != tt.want {
+				t.Errorf("isOperator(%+v) = %t, want %t", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Price is the cost of one million tokens of a model.
+type Price struct {
+	Prompt     float64 `toml:"prompt"`
+	Completion float64 `toml:"completion"`
+}
+
+// Budget caps LLM spend. When the daily or monthly spend is reached the bot
+// switches to FallbackModel, or stops calling the model when there is none.
+// Zero caps mean no limit.
+type Budget struct {
+	Daily         float64          `toml:"daily"`
+	Monthly       float64          `toml:"monthly"`
+	FallbackModel string           `toml:"fallbackModel"`
+	Prices        map[string]Price `toml:"prices"`
+}
+
+func (b *Budget) Validate() error {
+	var errs error
+
+	if b.Daily < 0 {
+		errs = errors.Join(errs, fmt.Errorf("daily %w", ErrMustBePositive))
+	}
+	if b.Monthly < 0 {
+		errs = errors.Join(errs, fmt.Errorf("monthly %w", ErrMustBePositive))
+	}
+	for model, price := range b.Prices {
+		if price.Prompt < 0 || price.Completion < 0 {
+			errs = errors.Join(errs, fmt.Errorf("price of %s %w", model, ErrMustBePositive))
+		}
+	}
+
+	return errs
+}
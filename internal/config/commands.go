@@ -0,0 +1,38 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Commands configures in-chat commands such as "!bot pause". Only operators
+// may use them; without operators commands are ignored. Operators are Discord
+// user IDs. Display names can be set by anyone, so names are matched only
+// with AllowNames.
+type Commands struct {
+	Prefix     string   `toml:"prefix"`
+	Operators  []string `toml:"operators"`
+	AllowNames bool     `toml:"allowNames"`
+}
+
+func (c *Commands) Validate() error {
+	var errs error
+
+	if strings.ContainsAny(c.Prefix, " \t\n") {
+		errs = errors.Join(errs, fmt.Errorf("prefix must be a single word"))
+	}
+	for i, operator := range c.Operators {
+		operator = strings.TrimSpace(operator)
+		if operator == "" {
+			errs = errors.Join(errs, fmt.Errorf("operator #%d %w", i, ErrMissing))
+			continue
+		}
+		if _, err := strconv.ParseUint(operator, 10, 64); err != nil && !c.AllowNames {
+			errs = errors.Join(errs, fmt.Errorf("operator %q is not a user ID, names need allowNames", operator))
+		}
+	}
+
+	return errs
+}
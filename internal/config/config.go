@@ -14,18 +14,61 @@ var (
 )
 
 type Config struct {
-	SiteConfigs              []SiteConfig  `toml:"siteConfigs"`
-	PauseBetweenQueries      time.Duration `toml:"pauseBetweenQueries"`
-	PauseAfterError          time.Duration `toml:"pauseAfterError"`
-	ExpectedResponseTime     time.Duration `toml:"expectedResponseTime"`
-	TypingSpeedOneCharacter  time.Duration `toml:"typingSpeedOneCharacter"`
-	SuggestionUpdateTimeout  time.Duration `toml:"suggestionUpdateTimeout"`
-	TipsParentElementTimeout time.Duration `toml:"tipsParentElementTimeout"`
-	RetryDelayOpenSite       time.Duration `toml:"retryDelayOpenSite"`
-	RetriesOpenSite          int           `toml:"retriesOpenSite"`
-	SavePath                 string        `toml:"savePath"`
-	RemoveDirAfter           bool          `toml:"removeDirAfter"`
-	Headless                 bool          `toml:"headless"`
+	SiteConfigs              []SiteConfig    `toml:"siteConfigs"`
+	PauseBetweenQueries      time.Duration   `toml:"pauseBetweenQueries"`
+	PauseAfterError          time.Duration   `toml:"pauseAfterError"`
+	ExpectedResponseTime     time.Duration   `toml:"expectedResponseTime"`
+	TypingSpeedOneCharacter  time.Duration   `toml:"typingSpeedOneCharacter"`
+	SuggestionUpdateTimeout  time.Duration   `toml:"suggestionUpdateTimeout"`
+	TipsParentElementTimeout time.Duration   `toml:"tipsParentElementTimeout"`
+	RetryDelayOpenSite       time.Duration   `toml:"retryDelayOpenSite"`
+	RetriesOpenSite          int             `toml:"retriesOpenSite"`
+	SavePath                 string          `toml:"savePath"`
+	SessionFile              string          `toml:"sessionFile"`
+	RemoveDirAfter           bool            `toml:"removeDirAfter"`
+	Headless                 bool            `toml:"headless"`
+	ReplyDelayMin            time.Duration   `toml:"replyDelayMin"`
+	ReplyDelayMax            time.Duration   `toml:"replyDelayMax"`
+	MaxMessageLength         int             `toml:"maxMessageLength"`
+	ChunkGapMin              time.Duration   `toml:"chunkGapMin"`
+	ChunkGapMax              time.Duration   `toml:"chunkGapMax"`
+	LLMURL                   string          `toml:"llmURL"`
+	Model                    string          `toml:"model"`
+	Budget                   Budget          `toml:"budget"`
+	PromptTokenBudget        int             `toml:"promptTokenBudget"`
+	ReplyMaxTokens           int             `toml:"replyMaxTokens"`
+	SummarizeHistory         bool            `toml:"summarizeHistory"`
+	SummaryMaxTokens         int             `toml:"summaryMaxTokens"`
+	Examples                 []Example       `toml:"examples"`
+	Personas                 []Persona       `toml:"personas"`
+	DMs                      DMs             `toml:"dms"`
+	Schedule                 []ScheduledPost `toml:"schedule"`
+	Commands                 Commands        `toml:"commands"`
+	AutoStart                bool            `toml:"autoStart"`
+	DryRun                   bool            `toml:"dryRun"`
+	StructuredOutput         bool            `toml:"structuredOutput"`
+	NativeReply              bool            `toml:"nativeReply"`
+	ReplyPing                bool            `toml:"replyPing"`
+	BlockedWords             []string        `toml:"blockedWords"`
+	Triggers                 []TriggerRule   `toml:"triggers"`
+	Reactions                []ReactionRule  `toml:"reactions"`
+	RateLimits               RateLimits      `toml:"rateLimits"`
+	MetricsAddr              string          `toml:"metricsAddr"`
+	AdminAddr                string          `toml:"adminAddr"`
+	AdminToken               string          `toml:"adminToken"`
+	Memory                   Memory          `toml:"memory"`
+	Knowledge                Knowledge       `toml:"knowledge"`
+	Tools                    Tools           `toml:"tools"`
+	Vision                   Vision          `toml:"vision"`
+	Edits                    Edits           `toml:"edits"`
+	SnapshotMinInterval      time.Duration   `toml:"snapshotMinInterval"`
+	SnapshotMaxCount         int             `toml:"snapshotMaxCount"`
+}
+
+// Example is a persona few-shot exchange sent before the history.
+type Example struct {
+	User      string `toml:"user"`
+	Assistant string `toml:"assistant"`
 }
 
 func (c *Config) Validate() error {
@@ -40,6 +83,108 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	for i, rule := range c.Triggers {
+		if err := rule.Validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("trigger #%d not valid: %w", i, err))
+		}
+	}
+	for i, rule := range c.Reactions {
+		if err := rule.Validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("reaction #%d not valid: %w", i, err))
+		}
+	}
+	posts := make(map[string]bool, len(c.Schedule))
+	for i, post := range c.Schedule {
+		if err := post.Validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("schedule #%d not valid: %w", i, err))
+		}
+		if posts[post.Name] {
+			errs = errors.Join(errs, fmt.Errorf("scheduled post %s is defined twice", post.Name))
+		}
+		posts[post.Name] = true
+	}
+
+	if err := c.RateLimits.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("rateLimits not valid: %w", err))
+	}
+
+	if err := c.Budget.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("budget not valid: %w", err))
+	}
+
+	if c.AdminAddr != "" && c.AdminToken == "" {
+		errs = errors.Join(errs, fmt.Errorf("adminToken %w", ErrMissing))
+	}
+	if err := c.Memory.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("memory not valid: %w", err))
+	}
+	if err := c.Knowledge.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("knowledge not valid: %w", err))
+	}
+	if err := c.Tools.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("tools not valid: %w", err))
+	}
+	if err := c.Vision.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("vision not valid: %w", err))
+	}
+	if err := c.Edits.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("edits not valid: %w", err))
+	}
+
+	if c.ReplyMaxTokens < 0 {
+		errs = errors.Join(errs, fmt.Errorf("replyMaxTokens %w", ErrMustBePositive))
+	}
+	if c.PromptTokenBudget < 0 {
+		errs = errors.Join(errs, fmt.Errorf("promptTokenBudget %w", ErrMustBePositive))
+	}
+	if c.SummaryMaxTokens < 0 {
+		errs = errors.Join(errs, fmt.Errorf("summaryMaxTokens %w", ErrMustBePositive))
+	}
+	for i, example := range c.Examples {
+		if example.User == "" || example.Assistant == "" {
+			errs = errors.Join(errs, fmt.Errorf("example #%d: user and assistant %w", i, ErrMissing))
+		}
+	}
+	personas := make(map[string]bool, len(c.Personas))
+	dmPersonas := make(map[string]bool)
+	for i, persona := range c.Personas {
+		if err := persona.Validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("persona #%d not valid: %w", i, err))
+		}
+		if personas[persona.Name] {
+			errs = errors.Join(errs, fmt.Errorf("persona %s is defined twice", persona.Name))
+		}
+		personas[persona.Name] = true
+		dmPersonas[persona.Name] = persona.DMs
+	}
+	if err := c.Commands.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("commands not valid: %w", err))
+	}
+	if err := c.DMs.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("dms not valid: %w", err))
+	}
+	if c.DMs.Enabled && c.DMs.Persona != "" {
+		if !personas[c.DMs.Persona] {
+			errs = errors.Join(errs, fmt.Errorf("dms: unknown persona %s", c.DMs.Persona))
+		} else if !dmPersonas[c.DMs.Persona] {
+			errs = errors.Join(errs, fmt.Errorf("dms: persona %s does not answer DMs", c.DMs.Persona))
+		}
+	}
+	for _, rule := range c.Reactions {
+		for _, name := range rule.Personas {
+			if name != DefaultPersonaName && !personas[name] {
+				errs = errors.Join(errs, fmt.Errorf("reaction %s: unknown persona %s", rule.Name, name))
+			}
+		}
+	}
+	for i, sc := range c.SiteConfigs {
+		for _, channel := range sc.Channels {
+			if channel.Persona != "" && !personas[channel.Persona] {
+				errs = errors.Join(errs, fmt.Errorf("siteConfig #%d: channel %s: unknown persona %s", i, channel.URL, channel.Persona))
+			}
+		}
+	}
+
 	if c.PauseBetweenQueries < 0 {
 		errs = errors.Join(errs, fmt.Errorf("pauseBetweenQueries %w", ErrMustBePositive))
 	}
@@ -67,18 +212,45 @@ func (c *Config) Validate() error {
 	if c.SavePath == "" {
 		errs = errors.Join(errs, fmt.Errorf("savePath is %w", ErrMissing))
 	}
+	if c.ReplyDelayMin < 0 {
+		errs = errors.Join(errs, fmt.Errorf("replyDelayMin %w", ErrMustBePositive))
+	}
+	if c.ReplyDelayMax < 0 {
+		errs = errors.Join(errs, fmt.Errorf("replyDelayMax %w", ErrMustBePositive))
+	}
+	if c.ReplyDelayMax < c.ReplyDelayMin {
+		errs = errors.Join(errs, fmt.Errorf("replyDelayMax must not be less than replyDelayMin"))
+	}
+	if c.MaxMessageLength < 0 {
+		errs = errors.Join(errs, fmt.Errorf("maxMessageLength %w", ErrMustBePositive))
+	}
+	if c.ChunkGapMin < 0 {
+		errs = errors.Join(errs, fmt.Errorf("chunkGapMin %w", ErrMustBePositive))
+	}
+	if c.ChunkGapMax < c.ChunkGapMin {
+		errs = errors.Join(errs, fmt.Errorf("chunkGapMax must not be less than chunkGapMin"))
+	}
+	if c.LLMURL != "" {
+		if _, err := url.Parse(c.LLMURL); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("llmURL not valid: %w", err))
+		}
+	}
+	if c.SnapshotMinInterval < 0 {
+		errs = errors.Join(errs, fmt.Errorf("snapshotMinInterval %w", ErrMustBePositive))
+	}
+	if c.SnapshotMaxCount < 0 {
+		errs = errors.Join(errs, fmt.Errorf("snapshotMaxCount %w", ErrMustBePositive))
+	}
 
 	return errs
 }
 
 type SiteConfig struct {
-	SiteURL                   string `yaml:"siteURL"`
-	SearchInputSelector       string `toml:"searchInputSelector"`
-	TagsSelector              string `toml:"tagsSelector"`
-	RequestsSelector          string `toml:"requestsSelector"`
-	InitialRequestsSelector   string `toml:"initialRequestsSelector"`
-	BrandsSelector            string `toml:"brandsSelector"`
-	TipsParentElementSelector string `toml:"tipsParentElementSelector"`
+	SiteURL   string    `toml:"siteURL"`
+	Selectors Selectors `toml:"selectors"`
+	// Channels are watched side by side, each in its own page. Without
+	// channels the bot watches the page the operator navigated to.
+	Channels []Channel `toml:"channels"`
 }
 
 func (sc *SiteConfig) Validate() error {
@@ -90,25 +262,106 @@ func (sc *SiteConfig) Validate() error {
 	if _, err := url.Parse(sc.SiteURL); err != nil {
 		errs = errors.Join(errs, fmt.Errorf("siteURL not valid: %w", err))
 	}
+	for i, channel := range sc.Channels {
+		if err := channel.Validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("channel #%d not valid: %w", i, err))
+		}
+	}
+
+	return errs
+}
 
-	if sc.SearchInputSelector == "" {
-		errs = errors.Join(errs, fmt.Errorf("searchInputSelector %w", ErrMissing))
+const (
+	DefaultMessageSelector        = "div[role='article']"
+	DefaultAuthorSelector         = "h3 span span"
+	DefaultAvatarSelector         = "img[class*='avatar']"
+	DefaultMentionSelector        = "div[class*='markup'] span.mention"
+	DefaultContentSelector        = "div[class*='contents'] > div[class*='markup']"
+	DefaultReplyContextSelector   = "div[id^='message-reply-context-']"
+	DefaultReplyAuthorSelector    = "span[class*='username']"
+	DefaultTextboxSelector        = "div[role='textbox']"
+	DefaultReplyButtonSelector    = "div[role='button'][aria-label='Reply']"
+	DefaultReplyPingSelector      = "div[class*='replyBar'] div[role='switch']"
+	DefaultImageSelector          = "div[id^='message-accessories-'] img"
+	DefaultReactionButtonSelector = "div[role='button'][aria-label='Add Reaction']"
+	DefaultEmojiSearchSelector    = "div[class*='emojiPicker'] input"
+	DefaultEditButtonSelector     = "div[role='button'][aria-label='Edit']"
+	DefaultDeleteButtonSelector   = "div[role='button'][aria-label='Delete']"
+	DefaultUnreadDMSelector       = "nav[class*='guilds'] a[href^='/channels/@me/']"
+)
+
+// Selectors locate chat elements on the page. Author, avatar, mention, content,
+// image, reply context and the message toolbar button selectors are relative
+// to a message element, reply author is relative to the reply context. Empty
+// fields fall back to the Discord defaults.
+type Selectors struct {
+	Message        string `toml:"message"`
+	Author         string `toml:"author"`
+	Avatar         string `toml:"avatar"`
+	Mention        string `toml:"mention"`
+	Content        string `toml:"content"`
+	Image          string `toml:"image"`
+	ReplyContext   string `toml:"replyContext"`
+	ReplyAuthor    string `toml:"replyAuthor"`
+	Textbox        string `toml:"textbox"`
+	ReplyButton    string `toml:"replyButton"`
+	ReplyPing      string `toml:"replyPing"`
+	ReactionButton string `toml:"reactionButton"`
+	EmojiSearch    string `toml:"emojiSearch"`
+	EditButton     string `toml:"editButton"`
+	DeleteButton   string `toml:"deleteButton"`
+	UnreadDM       string `toml:"unreadDM"`
+}
+
+func (s Selectors) WithDefaults() Selectors {
+	if s.Message == "" {
+		s.Message = DefaultMessageSelector
+	}
+	if s.Author == "" {
+		s.Author = DefaultAuthorSelector
+	}
+	if s.Avatar == "" {
+		s.Avatar = DefaultAvatarSelector
+	}
+	if s.Mention == "" {
+		s.Mention = DefaultMentionSelector
 	}
-	if sc.TagsSelector == "" {
-		errs = errors.Join(errs, fmt.Errorf("tagsSelector %w", ErrMissing))
+	if s.Content == "" {
+		s.Content = DefaultContentSelector
 	}
-	if sc.RequestsSelector == "" {
-		errs = errors.Join(errs, fmt.Errorf("requestsSelector %w", ErrMissing))
+	if s.Image == "" {
+		s.Image = DefaultImageSelector
 	}
-	if sc.InitialRequestsSelector == "" {
-		errs = errors.Join(errs, fmt.Errorf("initialRequestsSelector %w", ErrMissing))
+	if s.ReplyContext == "" {
+		s.ReplyContext = DefaultReplyContextSelector
 	}
-	if sc.BrandsSelector == "" {
-		errs = errors.Join(errs, fmt.Errorf("brandsSelector %w", ErrMissing))
+	if s.ReplyAuthor == "" {
+		s.ReplyAuthor = DefaultReplyAuthorSelector
 	}
-	if sc.TipsParentElementSelector == "" {
-		errs = errors.Join(errs, fmt.Errorf("tipsParentElementSelector %w", ErrMissing))
+	if s.Textbox == "" {
+		s.Textbox = DefaultTextboxSelector
+	}
+	if s.ReplyButton == "" {
+		s.ReplyButton = DefaultReplyButtonSelector
+	}
+	if s.ReplyPing == "" {
+		s.ReplyPing = DefaultReplyPingSelector
+	}
+	if s.ReactionButton == "" {
+		s.ReactionButton = DefaultReactionButtonSelector
+	}
+	if s.EmojiSearch == "" {
+		s.EmojiSearch = DefaultEmojiSearchSelector
+	}
+	if s.EditButton == "" {
+		s.EditButton = DefaultEditButtonSelector
+	}
+	if s.DeleteButton == "" {
+		s.DeleteButton = DefaultDeleteButtonSelector
+	}
+	if s.UnreadDM == "" {
+		s.UnreadDM = DefaultUnreadDMSelector
 	}
 
-	return errs
+	return s
 }
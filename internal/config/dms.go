@@ -0,0 +1,22 @@
+package config
+
+import (
+	"fmt"
+)
+
+// DMs configures answering direct messages. Every DM message is addressed to
+// the bot, so triggers don't apply; rate limits are separate from channels.
+type DMs struct {
+	Enabled bool `toml:"enabled"`
+	// Persona answers DMs, the built-in persona when empty. A named persona
+	// must have dms switched on.
+	Persona    string     `toml:"persona"`
+	RateLimits RateLimits `toml:"rateLimits"`
+}
+
+func (d *DMs) Validate() error {
+	if err := d.RateLimits.Validate(); err != nil {
+		return fmt.Errorf("rateLimits not valid: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	OnDeleteKeep   = "keep"
+	OnDeleteDelete = "delete"
+	OnDeleteEdit   = "edit"
+)
+
+// Edits configures what happens when users edit or delete messages the bot
+// has already seen.
+type Edits struct {
+	// Reevaluate runs the triggers again when the content of a message the
+	// bot did not answer changes, for example when a mention is added.
+	Reevaluate bool `toml:"reevaluate"`
+	// OnDelete is what happens to the bot's reply when the message it answered
+	// is deleted: keep it, delete it or replace its text with DeletedText.
+	OnDelete    string `toml:"onDelete"`
+	DeletedText string `toml:"deletedText"`
+}
+
+func (e *Edits) Validate() error {
+	var errs error
+
+	switch e.OnDelete {
+	case "", OnDeleteKeep, OnDeleteDelete:
+	case OnDeleteEdit:
+		if e.DeletedText == "" {
+			errs = errors.Join(errs, fmt.Errorf("deletedText %w", ErrMissing))
+		}
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown onDelete %q", e.OnDelete))
+	}
+
+	return errs
+}
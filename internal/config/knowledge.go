@@ -0,0 +1,36 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Knowledge configures answers from the server's markdown docs. The index is
+// built from Dir by the index command and kept in SavePath.
+type Knowledge struct {
+	// Dir holds the *.md files, searched recursively. Empty disables the
+	// knowledge base.
+	Dir string `toml:"dir"`
+	// ChunkWords is the approximate size of an indexed passage.
+	ChunkWords int `toml:"chunkWords"`
+	// TopK passages are added to the prompt.
+	TopK int `toml:"topK"`
+	// MinScore leaves out weak matches.
+	MinScore float64 `toml:"minScore"`
+}
+
+func (k *Knowledge) Validate() error {
+	var errs error
+
+	if k.ChunkWords < 0 {
+		errs = errors.Join(errs, fmt.Errorf("chunkWords %w", ErrMustBePositive))
+	}
+	if k.TopK < 0 {
+		errs = errors.Join(errs, fmt.Errorf("topK %w", ErrMustBePositive))
+	}
+	if k.MinScore < 0 {
+		errs = errors.Join(errs, fmt.Errorf("minScore %w", ErrMustBePositive))
+	}
+
+	return errs
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Default is the configuration used when no config file is given.
+func Default() Config {
+	return Config{
+		SavePath:    "videos",
+		SessionFile: "videos/session.json",
+		NativeReply: true,
+		SiteConfigs: []SiteConfig{
+			{
+				SiteURL: "https://discord.com/",
+			},
+		},
+	}
+}
+
+// Load reads a TOML config file on top of Default. Keys missing from the
+// file keep their default values.
+func Load(path string) (Config, error) {
+	conf := Default()
+	if path == "" {
+		return conf, nil
+	}
+
+	meta, err := toml.DecodeFile(path, &conf)
+	if err != nil {
+		return conf, fmt.Errorf("can't decode config %s: %w", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return conf, fmt.Errorf("unknown keys in config %s: %v", path, undecoded)
+	}
+
+	return conf, nil
+}
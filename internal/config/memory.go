@@ -0,0 +1,30 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Memory configures long-term facts the bot remembers about users.
+type Memory struct {
+	Enabled bool `toml:"enabled"`
+	// MaxFacts per user; the oldest facts are forgotten first.
+	MaxFacts int `toml:"maxFacts"`
+	// Model extracts facts, the reply model when empty.
+	Model string `toml:"model"`
+	// MinWords a message needs before facts are extracted from it.
+	MinWords int `toml:"minWords"`
+}
+
+func (m *Memory) Validate() error {
+	var errs error
+
+	if m.MaxFacts < 0 {
+		errs = errors.Join(errs, fmt.Errorf("maxFacts %w", ErrMustBePositive))
+	}
+	if m.MinWords < 0 {
+		errs = errors.Join(errs, fmt.Errorf("minWords %w", ErrMustBePositive))
+	}
+
+	return errs
+}
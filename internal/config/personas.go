@@ -0,0 +1,57 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// DefaultPersonaName is the name of the built-in persona.
+const DefaultPersonaName = "default"
+
+// Persona is a system prompt with its few-shot examples. Channels refer to
+// personas by name; channels without one use the built-in persona and the
+// top-level examples. DMs switches direct messages on for the persona.
+type Persona struct {
+	Name     string    `toml:"name"`
+	Prompt   string    `toml:"prompt"`
+	Examples []Example `toml:"examples"`
+	DMs      bool      `toml:"dms"`
+}
+
+func (p *Persona) Validate() error {
+	var errs error
+
+	if p.Name == "" {
+		errs = errors.Join(errs, fmt.Errorf("name %w", ErrMissing))
+	}
+	if p.Prompt == "" {
+		errs = errors.Join(errs, fmt.Errorf("prompt %w", ErrMissing))
+	}
+	for i, example := range p.Examples {
+		if example.User == "" || example.Assistant == "" {
+			errs = errors.Join(errs, fmt.Errorf("example #%d: user and assistant %w", i, ErrMissing))
+		}
+	}
+
+	return errs
+}
+
+// Channel is a channel, thread or forum post the bot watches.
+type Channel struct {
+	URL string `toml:"url"`
+	// Persona answers in the channel, the default persona when empty.
+	Persona string `toml:"persona"`
+}
+
+func (c *Channel) Validate() error {
+	var errs error
+
+	if c.URL == "" {
+		errs = errors.Join(errs, fmt.Errorf("url %w", ErrMissing))
+	} else if u, err := url.Parse(c.URL); err != nil || u.Host == "" {
+		errs = errors.Join(errs, fmt.Errorf("url %q not valid", c.URL))
+	}
+
+	return errs
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	OverflowDrop     = "drop"
+	OverflowCoalesce = "coalesce"
+	OverflowNotify   = "notify"
+)
+
+// RateLimit is a token bucket: one reply token is added every Every, up to
+// Burst tokens. A zero Every means no limit.
+type RateLimit struct {
+	Every time.Duration `toml:"every"`
+	Burst int           `toml:"burst"`
+}
+
+func (r *RateLimit) Validate() error {
+	var errs error
+
+	if r.Every < 0 {
+		errs = errors.Join(errs, fmt.Errorf("every %w", ErrMustBePositive))
+	}
+	if r.Burst < 0 {
+		errs = errors.Join(errs, fmt.Errorf("burst %w", ErrMustBePositive))
+	}
+
+	return errs
+}
+
+// RateLimits bound how often the bot replies. Overflow is what happens to a
+// message over the limit: drop it, coalesce it with the following ones into a
+// single reply once tokens are back, or notify the author with SlowDownMessage.
+type RateLimits struct {
+	PerAuthor       RateLimit `toml:"perAuthor"`
+	PerChannel      RateLimit `toml:"perChannel"`
+	Global          RateLimit `toml:"global"`
+	Overflow        string    `toml:"overflow"`
+	SlowDownMessage string    `toml:"slowDownMessage"`
+}
+
+func (r *RateLimits) Validate() error {
+	var errs error
+
+	if err := r.PerAuthor.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("perAuthor not valid: %w", err))
+	}
+	if err := r.PerChannel.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("perChannel not valid: %w", err))
+	}
+	if err := r.Global.Validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("global not valid: %w", err))
+	}
+
+	switch r.Overflow {
+	case "", OverflowDrop, OverflowCoalesce:
+	case OverflowNotify:
+		if r.SlowDownMessage == "" {
+			errs = errors.Join(errs, fmt.Errorf("slowDownMessage %w", ErrMissing))
+		}
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown overflow %q", r.Overflow))
+	}
+
+	return errs
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ReactionRule adds an emoji reaction to answered messages whose content
+// matches Pattern. With Only the bot reacts instead of replying and the model
+// is not called.
+type ReactionRule struct {
+	Name    string `toml:"name"`
+	Pattern string `toml:"pattern"`
+	// Emoji is a unicode emoji or a Discord emoji name such as "skull".
+	Emoji       string  `toml:"emoji"`
+	Probability float64 `toml:"probability"`
+	Only        bool    `toml:"only"`
+	// Personas limits the rule to channels answered by these personas, all
+	// channels when empty.
+	Personas []string `toml:"personas"`
+}
+
+func (r *ReactionRule) Validate() error {
+	var errs error
+
+	if r.Name == "" {
+		errs = errors.Join(errs, fmt.Errorf("name %w", ErrMissing))
+	}
+	if r.Emoji == "" {
+		errs = errors.Join(errs, fmt.Errorf("emoji %w", ErrMissing))
+	}
+	if _, err := regexp.Compile(r.Pattern); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("pattern not valid: %w", err))
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		errs = errors.Join(errs, fmt.Errorf("probability must be in [0, 1]"))
+	}
+
+	return errs
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/shushard/ChatBot/internal/cron"
+)
+
+// ScheduledPost is a message the bot posts on its own: on a cron schedule,
+// once a channel has been idle for IdleAfter, or once At a given time. Text
+// is posted as is, Prompt asks the channel persona to write the post; both
+// are Go templates with .Now, .Channel and .Persona.
+type ScheduledPost struct {
+	Name string `toml:"name"`
+	// Channel is the URL of a watched channel, every channel when empty.
+	Channel   string        `toml:"channel"`
+	Cron      string        `toml:"cron"`
+	IdleAfter time.Duration `toml:"idleAfter"`
+	At        time.Time     `toml:"at"`
+	Text      string        `toml:"text"`
+	Prompt    string        `toml:"prompt"`
+}
+
+func (p *ScheduledPost) Validate() error {
+	var errs error
+
+	if p.Name == "" {
+		errs = errors.Join(errs, fmt.Errorf("name %w", ErrMissing))
+	}
+
+	when := 0
+	if p.Cron != "" {
+		when++
+		if _, err := cron.Parse(p.Cron); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+	if p.IdleAfter != 0 {
+		when++
+		if p.IdleAfter < 0 {
+			errs = errors.Join(errs, fmt.Errorf("idleAfter %w", ErrMustBePositive))
+		}
+	}
+	if !p.At.IsZero() {
+		when++
+	}
+	if when != 1 {
+		errs = errors.Join(errs, fmt.Errorf("exactly one of cron, idleAfter and at is required"))
+	}
+
+	switch {
+	case p.Text == "" && p.Prompt == "":
+		errs = errors.Join(errs, fmt.Errorf("text or prompt %w", ErrMissing))
+	case p.Text != "" && p.Prompt != "":
+		errs = errors.Join(errs, fmt.Errorf("only one of text and prompt is allowed"))
+	}
+	if _, err := template.New(p.Name).Parse(p.Text + p.Prompt); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("template not valid: %w", err))
+	}
+
+	return errs
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	ToolTime           = "time"
+	ToolDice           = "dice"
+	ToolKnowledge      = "knowledge"
+	ToolRecentMessages = "recentMessages"
+)
+
+// Tools are functions the model may call while composing a reply. The model
+// endpoint must support OpenAI tool calling.
+type Tools struct {
+	// Enabled tools; none by default.
+	Enabled []string `toml:"enabled"`
+	// MaxRounds of tool calls per reply before the model must answer.
+	MaxRounds int `toml:"maxRounds"`
+}
+
+func (t *Tools) Validate() error {
+	var errs error
+
+	for _, name := range t.Enabled {
+		switch name {
+		case ToolTime, ToolDice, ToolKnowledge, ToolRecentMessages:
+		default:
+			errs = errors.Join(errs, fmt.Errorf("unknown tool %q", name))
+		}
+	}
+	if t.MaxRounds < 0 {
+		errs = errors.Join(errs, fmt.Errorf("maxRounds %w", ErrMustBePositive))
+	}
+
+	return errs
+}
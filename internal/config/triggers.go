@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	TriggerMention  = "mention"
+	TriggerReply    = "reply"
+	TriggerKeyword  = "keyword"
+	TriggerRegex    = "regex"
+	TriggerDM       = "dm"
+	TriggerFollowUp = "followUp"
+	TriggerRandom   = "random"
+)
+
+// TriggerRule decides whether the bot answers a message. Rules are tried from
+// the highest priority down; the first matching rule that is not cooling down
+// wins, and when it is an exclusion the message is left unanswered.
+type TriggerRule struct {
+	Name string `toml:"name"`
+	Kind string `toml:"kind"`
+	// Channels limits the rule to channel URLs with one of these prefixes.
+	Channels []string `toml:"channels"`
+	// Authors limits the rule to these usernames.
+	Authors  []string `toml:"authors"`
+	Keywords []string `toml:"keywords"`
+	Pattern  string   `toml:"pattern"`
+	// Within is the follow-up window after the bot's last message.
+	Within      time.Duration `toml:"within"`
+	Probability float64       `toml:"probability"`
+	Priority    int           `toml:"priority"`
+	Cooldown    time.Duration `toml:"cooldown"`
+	Exclude     bool          `toml:"exclude"`
+}
+
+// DefaultTriggers answer mentions and replies to the bot, which is what the
+// bot did before rules existed.
+func DefaultTriggers() []TriggerRule {
+	return []TriggerRule{
+		{Name: TriggerMention, Kind: TriggerMention},
+		{Name: TriggerReply, Kind: TriggerReply},
+	}
+}
+
+func (r *TriggerRule) Validate() error {
+	var errs error
+
+	if r.Name == "" {
+		errs = errors.Join(errs, fmt.Errorf("name %w", ErrMissing))
+	}
+
+	switch r.Kind {
+	case TriggerMention, TriggerReply, TriggerDM:
+	case TriggerKeyword:
+		if len(r.Keywords) == 0 {
+			errs = errors.Join(errs, fmt.Errorf("keywords %w", ErrMissing))
+		}
+	case TriggerRegex:
+		if r.Pattern == "" {
+			errs = errors.Join(errs, fmt.Errorf("pattern %w", ErrMissing))
+		} else if _, err := regexp.Compile(r.Pattern); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("pattern not valid: %w", err))
+		}
+	case TriggerFollowUp:
+		if r.Within <= 0 {
+			errs = errors.Join(errs, fmt.Errorf("within %w", ErrMustBePositive))
+		}
+	case TriggerRandom:
+		if r.Probability <= 0 || r.Probability > 1 {
+			errs = errors.Join(errs, fmt.Errorf("probability must be in (0, 1]"))
+		}
+	case "":
+		errs = errors.Join(errs, fmt.Errorf("kind %w", ErrMissing))
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown kind %q", r.Kind))
+	}
+
+	if r.Cooldown < 0 {
+		errs = errors.Join(errs, fmt.Errorf("cooldown %w", ErrMustBePositive))
+	}
+
+	return errs
+}
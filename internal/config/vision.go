@@ -0,0 +1,33 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Vision configures images attached to or embedded in messages, which are
+// sent to a vision-capable model.
+type Vision struct {
+	Enabled bool `toml:"enabled"`
+	// Model answers messages with images, the reply model when empty.
+	Model string `toml:"model"`
+	// MaxImages per message; the rest are ignored.
+	MaxImages int `toml:"maxImages"`
+	// MaxBytes per image; larger images are skipped.
+	MaxBytes int64 `toml:"maxBytes"`
+	// Types are the accepted MIME types.
+	Types []string `toml:"types"`
+}
+
+func (v *Vision) Validate() error {
+	var errs error
+
+	if v.MaxImages < 0 {
+		errs = errors.Join(errs, fmt.Errorf("maxImages %w", ErrMustBePositive))
+	}
+	if v.MaxBytes < 0 {
+		errs = errors.Join(errs, fmt.Errorf("maxBytes %w", ErrMustBePositive))
+	}
+
+	return errs
+}
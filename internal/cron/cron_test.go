@@ -0,0 +1,82 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"step", "*/15 * * * *", date(2024, 1, 1, 10, 7), date(2024, 1, 1, 10, 15)},
+		{"strictly after", "0 * * * *", date(2024, 1, 1, 10, 0), date(2024, 1, 1, 11, 0)},
+		{"seconds", "0 * * * *", date(2024, 1, 1, 10, 59).Add(30 * time.Second), date(2024, 1, 1, 11, 0)},
+		{"range with step", "0 9-17/4 * * *", date(2024, 1, 1, 10, 0), date(2024, 1, 1, 13, 0)},
+		{"range wraps to next day", "0 9-17/4 * * *", date(2024, 1, 1, 17, 0), date(2024, 1, 2, 9, 0)},
+		{"weekdays", "30 8 * * 1-5", date(2024, 1, 5, 9, 0), date(2024, 1, 8, 8, 30)},
+		{"sunday as 0", "0 0 * * 0", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 0, 0)},
+		{"month list", "0 12 1 1,7 *", date(2024, 2, 1, 0, 0), date(2024, 7, 1, 12, 0)},
+		{"day of month", "0 0 13 * *", date(2024, 1, 1, 0, 0), date(2024, 1, 13, 0, 0)},
+		{"day of month or week, week first", "0 0 13 * 5", date(2024, 1, 1, 0, 0), date(2024, 1, 5, 0, 0)},
+		{"day of month or week, month first", "0 0 13 * 5", date(2024, 1, 12, 0, 0), date(2024, 1, 13, 0, 0)},
+		{"leap day", "0 0 29 2 *", date(2024, 3, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"never, february 30", "0 0 30 2 *", date(2024, 1, 1, 0, 0), time.Time{}},
+		{"never, april 31", "0 0 31 4 *", date(2024, 1, 1, 0, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.spec, err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) of %q = %s, want %s", tt.from, tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	s, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.Next(time.Date(2024, 1, 1, 10, 0, 0, 0, loc))
+	want := time.Date(2024, 1, 2, 9, 0, 0, 0, loc)
+	if !got.Equal(want) || got.Location() != loc {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+	}
+	for _, spec := range specs {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxReactionLength = 32
+
+const decisionPrompt = `Отвечай только JSON-объектом:
+{"should_reply": true или false, "reply_text": "текст ответа или пустая строка", "reaction_emoji": "один эмодзи или пустая строка", "reply_to_message_id": "ID сообщения или пустая строка"}
+Если сообщение не стоит ответа, верни should_reply false; можно поставить только реакцию.`
+
+const decisionMessageID = "\nID текущего сообщения: "
+
+var errInvalidDecision = errors.New("invalid reply decision")
+
+var decisionFields = []string{"should_reply", "reply_text", "reaction_emoji", "reply_to_message_id"}
+
+// replyDecision is the model output in structured output mode.
+type replyDecision struct {
+	ShouldReply      bool   `json:"should_reply"`
+	ReplyText        string `json:"reply_text"`
+	ReactionEmoji    string `json:"reaction_emoji"`
+	ReplyToMessageID string `json:"reply_to_message_id"`
+}
+
+// decisionResponseFormat is the response_format asking for a replyDecision.
+func decisionResponseFormat() map[string]interface{} {
+	str := map[string]interface{}{"type": "string"}
+	return map[string]interface{}{
+		"type": "json_schema",
+		"json_schema": map[string]interface{}{
+			"name":   "reply_decision",
+			"strict": true,
+			"schema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"should_reply":        map[string]interface{}{"type": "boolean"},
+					"reply_text":          str,
+					"reaction_emoji":      str,
+					"reply_to_message_id": str,
+				},
+				"required":             decisionFields,
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// parseDecision decodes and validates the model output against the
+// replyDecision schema.
+func parseDecision(content string) (replyDecision, error) {
+	var d replyDecision
+
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.Trim(content, "`\n ")
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(content), &fields); err != nil {
+		return d, fmt.Errorf("%w: %v", errInvalidDecision, err)
+	}
+	for _, name := range decisionFields {
+		if _, ok := fields[name]; !ok {
+			return d, fmt.Errorf("%w: %s is missing", errInvalidDecision, name)
+		}
+	}
+	if len(fields) != len(decisionFields) {
+		return d, fmt.Errorf("%w: unknown fields", errInvalidDecision)
+	}
+	if err := json.Unmarshal([]byte(content), &d); err != nil {
+		return d, fmt.Errorf("%w: %v", errInvalidDecision, err)
+	}
+
+	d.ReplyText = strings.TrimSpace(d.ReplyText)
+	d.ReactionEmoji = strings.TrimSpace(d.ReactionEmoji)
+	if d.ShouldReply && d.ReplyText == "" {
+		return d, fmt.Errorf("%w: should_reply without reply_text", errInvalidDecision)
+	}
+	if utf8.RuneCountInString(d.ReactionEmoji) > maxReactionLength {
+		return d, fmt.Errorf("%w: reaction_emoji is too long", errInvalidDecision)
+	}
+
+	return d, nil
+}
+
+// knownMessage reports whether id is the message being answered or a recent
+// message of the channel, the only ones the bot can reply to.
+func (s *Service) knownMessage(origin usageOrigin, id string) bool {
+	if id == origin.MessageID {
+		return true
+	}
+	for _, msg := range s.recentMessages[origin.Channel] {
+		if msg.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDecision fills the reply from the model decision.
+func (s *Service) applyDecision(r *reply, d replyDecision, origin usageOrigin) {
+	r.Silent = !d.ShouldReply
+	r.Reaction = d.ReactionEmoji
+	if d.ShouldReply {
+		r.Text = s.moderate(postProcess(d.ReplyText))
+	}
+
+	r.ReplyTo = d.ReplyToMessageID
+	if r.ReplyTo != "" && !s.knownMessage(origin, r.ReplyTo) {
+		s.logger.Warn().Str("id", r.ReplyTo).Msg("Model chose an unknown message to reply to, ignoring")
+		r.ReplyTo = ""
+	}
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fullReply is a reply at the persona limit of maxReplyWords words.
+var fullReply = strings.TrimSpace(strings.Repeat(
+	"Ты опять пишешь какую то ерунду\nникому не интересно это\n", 5))
+
+func fullDecision(t *testing.T) string {
+	t.Helper()
+
+	if n := len(strings.Fields(fullReply)); n != maxReplyWords {
+		t.Fatalf("reply has %d words, want %d", n, maxReplyWords)
+	}
+	content, err := json.Marshal(replyDecision{
+		ShouldReply:      true,
+		ReplyText:        fullReply,
+		ReactionEmoji:    "💀",
+		ReplyToMessageID: "chat-messages___chat-messages-1143906817251811409-1290745612345678901",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestParseDecisionFullReply(t *testing.T) {
+	content := fullDecision(t)
+
+	d, err := parseDecision(content)
+	if err != nil {
+		t.Fatalf("parseDecision: %v", err)
+	}
+	if !d.ShouldReply || d.ReplyText != fullReply || d.ReactionEmoji != "💀" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+
+	tok, err := newTokenizer(defaultModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := tok.count(content)
+	if n <= defaultMaxTokens {
+		t.Errorf("decision is %d tokens, expected it not to fit the plain reply limit %d", n, defaultMaxTokens)
+	}
+	if n > decisionMaxTokens {
+		t.Errorf("decision is %d tokens, over decisionMaxTokens %d", n, decisionMaxTokens)
+	}
+}
+
+func TestParseDecisionTruncated(t *testing.T) {
+	content := fullDecision(t)
+
+	// What the model returns when it runs out of completion tokens.
+	_, err := parseDecision(content[:len(content)/2])
+	if !errors.Is(err, errInvalidDecision) {
+		t.Errorf("got %v, want errInvalidDecision", err)
+	}
+}
+
+func TestParseDecision(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"silent", `{"should_reply": false, "reply_text": "", "reaction_emoji": "", "reply_to_message_id": ""}`, true},
+		{"code fence", "```json\n{\"should_reply\": true, \"reply_text\": \"ну\", \"reaction_emoji\": \"\", \"reply_to_message_id\": \"\"}\n```", true},
+		{"missing field", `{"should_reply": true, "reply_text": "ну", "reaction_emoji": ""}`, false},
+		{"unknown field", `{"should_reply": true, "reply_text": "ну", "reaction_emoji": "", "reply_to_message_id": "", "mood": "bad"}`, false},
+		{"reply without text", `{"should_reply": true, "reply_text": " ", "reaction_emoji": "", "reply_to_message_id": ""}`, false},
+		{"not json", `ну и что`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDecision(tt.content)
+			if (err == nil) != tt.valid {
+				t.Errorf("parseDecision(%q) error = %v, want valid %t", tt.content, err, tt.valid)
+			}
+		})
+	}
+}
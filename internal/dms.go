@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const (
+	dmListPath     = "/channels/@me"
+	dmTrigger      = "dm"
+	dmOpenTimeout  = 5 * time.Second
+	dmMessageDelay = 500 * time.Millisecond
+)
+
+// dmWatcher reads direct messages in a page of its own. DMs with unread
+// messages are opened from the server sidebar one by one; the last opened DM
+// stays open and is read every poll like a channel.
+type dmWatcher struct {
+	page     playwright.Page
+	persona  persona
+	limiter  *replyLimiter
+	channels map[string]*channelState
+	current  *channelState
+}
+
+// openDMs opens the DM list in a new page of the browser context when DMs are
+// enabled.
+func (s *Service) openDMs(page playwright.Page, siteConfig config.SiteConfig) error {
+	s.dms = nil
+	if !s.config.DMs.Enabled {
+		return nil
+	}
+
+	p, ok := s.persona(s.config.DMs.Persona)
+	if !ok {
+		return fmt.Errorf("unknown persona %s", s.config.DMs.Persona)
+	}
+
+	base, err := url.Parse(siteConfig.SiteURL)
+	if err != nil {
+		return fmt.Errorf("can't parse site URL: %w", err)
+	}
+	listURL := base.ResolveReference(&url.URL{Path: dmListPath}).String()
+
+	dmPage, err := page.Context().NewPage()
+	if err != nil {
+		return fmt.Errorf("can't create page for DMs: %w", err)
+	}
+	if _, err := dmPage.Goto(listURL, playwright.PageGotoOptions{
+		WaitUntil: playwright.WaitUntilStateNetworkidle,
+	}); err != nil {
+		return fmt.Errorf("can't go to DM list: %w", err)
+	}
+
+	s.dms = &dmWatcher{
+		page:     dmPage,
+		persona:  p,
+		limiter:  newReplyLimiter(s.config.DMs.RateLimits),
+		channels: make(map[string]*channelState),
+	}
+	s.logger.Info().Str("persona", p.name).Msg("Watching direct messages")
+
+	return nil
+}
+
+// readDMs reads the open DM, then opens and reads every DM with unread
+// messages, then every DM with coalesced messages still queued, so they are
+// answered even when nothing new arrives there. Nothing is read while the DM
+// persona has DMs switched off.
+func (s *Service) readDMs() error {
+	if s.dms == nil || !s.dms.persona.dms {
+		return nil
+	}
+
+	read := make(map[string]bool)
+	if s.dms.current != nil {
+		s.useChannel(s.dms.current)
+		if err := s.readChannel(); err != nil {
+			return err
+		}
+		read[s.dms.current.url] = true
+	}
+
+	links, err := s.dms.page.QuerySelectorAll(s.selectors.UnreadDM)
+	if err != nil {
+		s.captureFailure(nil, "unread DMs", s.selectors.UnreadDM)
+		return fmt.Errorf("failed to select unread DMs: %w", err)
+	}
+	// Opening a DM re-renders the sidebar, so collect the links first.
+	hrefs := make([]string, 0, len(links))
+	for _, link := range links {
+		href, err := link.GetAttribute("href")
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Failed to get DM link")
+			continue
+		}
+		if href != "" {
+			hrefs = append(hrefs, href)
+		}
+	}
+
+	for _, href := range hrefs {
+		if err := s.openDM(href); err != nil {
+			s.logger.Error().Err(err).Str("dm", href).Msg("Failed to open DM")
+			continue
+		}
+		if err := s.readChannel(); err != nil {
+			return err
+		}
+		read[href] = true
+	}
+
+	return s.flushDMs(read)
+}
+
+// flushDMs opens the DMs not read this poll that have coalesced messages
+// queued and reads them, which answers the queue once the limits allow.
+func (s *Service) flushDMs(read map[string]bool) error {
+	if s.paused {
+		return nil
+	}
+
+	hrefs := make([]string, 0, len(s.dms.channels))
+	for href := range s.dms.channels {
+		if !read[href] && s.dms.limiter.hasPending(href) {
+			hrefs = append(hrefs, href)
+		}
+	}
+	sort.Strings(hrefs)
+
+	for _, href := range hrefs {
+		if err := s.openDM(href); err != nil {
+			s.logger.Error().Err(err).Str("dm", href).Msg("Failed to open DM")
+			continue
+		}
+		if err := s.readChannel(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openDM clicks the sidebar link of a DM and makes it the current channel. A
+// DM opened for the first time is only unread from the bot's last message on.
+func (s *Service) openDM(href string) error {
+	link, err := s.dms.page.QuerySelector(fmt.Sprintf("a[href=%q]", href))
+	if err != nil {
+		return fmt.Errorf("failed to find DM link: %w", err)
+	}
+	if link == nil {
+		return fmt.Errorf("DM link not found")
+	}
+	if err := link.Click(); err != nil {
+		return fmt.Errorf("failed to click DM link: %w", err)
+	}
+	if err := s.dms.page.WaitForURL("**"+href, playwright.PageWaitForURLOptions{
+		Timeout: playwright.Float(float64(dmOpenTimeout.Milliseconds())),
+	}); err != nil {
+		return fmt.Errorf("DM did not open: %w", err)
+	}
+	// Give the message list a moment to replace the previous DM.
+	time.Sleep(dmMessageDelay)
+
+	ch, ok := s.dms.channels[href]
+	if !ok {
+		ch = newChannelState(href, s.dms.page, s.dms.persona, s.dms.limiter)
+		ch.dm = true
+		s.restoreHistory(ch)
+		s.dms.channels[href] = ch
+	}
+	s.dms.current = ch
+	s.useChannel(ch)
+
+	if !ok {
+		return s.initializeDM()
+	}
+	return nil
+}
+
+// initializeDM marks the messages of a newly opened DM as seen, except those
+// after the last message of the bot, which are what made the DM unread.
+func (s *Service) initializeDM() error {
+	messages, err := s.page.QuerySelectorAll(s.selectors.Message)
+	if err != nil {
+		return fmt.Errorf("failed to select message elements: %w", err)
+	}
+
+	var unanswered []string
+	var previous messageAuthor
+	for _, message := range messages {
+		id, err := message.GetAttribute("data-list-item-id")
+		if err != nil || id == "" {
+			continue
+		}
+		s.channel.seenMessages[id] = true
+
+		msg, err := s.extractMessage(message, previous)
+		if err != nil {
+			previous = messageAuthor{}
+			continue
+		}
+		previous = msg.author()
+		s.channel.authors[id] = previous
+		if strings.EqualFold(msg.Author, s.botUsername) {
+			unanswered = unanswered[:0]
+		} else {
+			unanswered = append(unanswered, id)
+		}
+	}
+	for _, id := range unanswered {
+		delete(s.channel.seenMessages, id)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const (
+	doctorWaitTimeout  = 30 * time.Second
+	doctorSampleCount  = 3
+	doctorSampleLength = 40
+)
+
+var ErrDoctorFailed = errors.New("selector check failed")
+
+// selectorCheck is one line of the doctor report.
+type selectorCheck struct {
+	name     string
+	selector string
+	required bool
+	matches  int
+	samples  []string
+}
+
+func (c *selectorCheck) addSample(sample string) {
+	if sample == "" || len(c.samples) >= doctorSampleCount {
+		return
+	}
+	if runes := []rune(sample); len(runes) > doctorSampleLength {
+		sample = string(runes[:doctorSampleLength]) + "…"
+	}
+	c.samples = append(c.samples, strings.ReplaceAll(sample, "\n", " "))
+}
+
+// Doctor opens every configured site with the saved session and checks that
+// the configured selectors still match the live page. The report is written
+// to out; ErrDoctorFailed is returned when a required selector matches nothing.
+func (s *Service) Doctor(ctx context.Context, out io.Writer) (err error) {
+	pw, err := startPlaywright()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if tmpErr := pw.Stop(); tmpErr != nil {
+			err = errors.Join(err, fmt.Errorf("error stopping browser: %w", tmpErr))
+		}
+	}()
+
+	for _, siteConfig := range s.config.SiteConfigs {
+		if checkErr := s.doctorSite(ctx, pw, siteConfig, out); checkErr != nil {
+			err = errors.Join(err, fmt.Errorf("site %s: %w", siteConfig.SiteURL, checkErr))
+		}
+	}
+
+	return err
+}
+
+func (s *Service) doctorSite(
+	ctx context.Context,
+	pw *playwright.Playwright,
+	siteConfig config.SiteConfig,
+	out io.Writer,
+) (err error) {
+	browser, err := s.launchBrowser(pw)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if tmpErr := browser.Close(); tmpErr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing browser: %w", tmpErr))
+		}
+	}()
+
+	page, err := s.createPage(browser)
+	if err != nil {
+		return fmt.Errorf("can't create page: %w", err)
+	}
+
+	s.page = page
+	s.selectors = siteConfig.Selectors.WithDefaults()
+
+	if err := s.openSite(ctx, page, siteConfig); err != nil {
+		return fmt.Errorf("can't open site: %w", err)
+	}
+
+	if _, err := page.WaitForSelector(s.selectors.Message, playwright.PageWaitForSelectorOptions{
+		Timeout: playwright.Float(float64(doctorWaitTimeout.Milliseconds())),
+	}); err != nil {
+		s.logger.Warn().Err(err).Str("selector", s.selectors.Message).Msg("Messages did not appear")
+	}
+
+	checks, err := s.runSelectorChecks()
+	if err != nil {
+		return err
+	}
+
+	writeDoctorReport(out, siteConfig.SiteURL, checks)
+
+	fixturePath := filepath.Join(s.config.SavePath, fmt.Sprintf("fixture-%s%s", time.Now().Format("20060102-150405"), fixtureExt))
+	if err := CaptureFixture(page, s.selectors, fixturePath); err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to capture fixture")
+	} else {
+		fmt.Fprintf(out, "  message list saved to %s\n", fixturePath)
+	}
+
+	var failed []string
+	for _, check := range checks {
+		if check.required && check.matches == 0 {
+			failed = append(failed, check.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %s", ErrDoctorFailed, strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func (s *Service) runSelectorChecks() ([]*selectorCheck, error) {
+	message := &selectorCheck{name: "message", selector: s.selectors.Message, required: true}
+	author := &selectorCheck{name: "author", selector: s.selectors.Author, required: true}
+	content := &selectorCheck{name: "content", selector: s.selectors.Content, required: true}
+	mention := &selectorCheck{name: "mention", selector: s.selectors.Mention}
+	reply := &selectorCheck{name: "reply context", selector: s.selectors.ReplyContext}
+	textbox := &selectorCheck{name: "textbox", selector: s.selectors.Textbox, required: true}
+
+	elements, err := s.page.QuerySelectorAll(s.selectors.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select message elements: %w", err)
+	}
+	message.matches = len(elements)
+
+	// Read top to bottom so grouped messages get the author of the message
+	// above, as when reading the channel.
+	msgs := make([]chatMessage, 0, len(elements))
+	var previous messageAuthor
+	for _, element := range elements {
+		msg, err := s.extractMessage(element, previous)
+		if err != nil {
+			s.logger.Debug().Err(err).Msg("Failed to extract message")
+			previous = messageAuthor{}
+			continue
+		}
+		previous = msg.author()
+		msgs = append(msgs, msg)
+	}
+
+	// Newest messages are at the bottom, sample from there.
+	for i := len(msgs) - 1; i >= 0; i-- {
+		msg := msgs[i]
+		message.addSample(msg.ID)
+		if msg.Author != "" {
+			author.matches++
+			author.addSample(msg.Author)
+		}
+		if msg.HasContent {
+			content.matches++
+			content.addSample(msg.Content)
+		}
+		if len(msg.Mentions) > 0 {
+			mention.matches++
+			mention.addSample(strings.Join(msg.Mentions, " "))
+		}
+		if msg.ReplyAuthor != "" {
+			reply.matches++
+			reply.addSample(msg.ReplyAuthor)
+		}
+	}
+
+	textboxes, err := s.page.QuerySelectorAll(s.selectors.Textbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select text input box: %w", err)
+	}
+	textbox.matches = len(textboxes)
+
+	return []*selectorCheck{message, author, content, mention, reply, textbox}, nil
+}
+
+func writeDoctorReport(out io.Writer, siteURL string, checks []*selectorCheck) {
+	fmt.Fprintf(out, "site %s\n", siteURL)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, check := range checks {
+		status := "OK"
+		if check.matches == 0 {
+			status = "WARN"
+			if check.required {
+				status = "FAIL"
+			}
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%d\t%s\t%s\n",
+			status, check.name, check.matches, check.selector, strings.Join(check.samples, " | "))
+	}
+	w.Flush()
+}
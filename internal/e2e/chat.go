@@ -0,0 +1,271 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// ChatMessage is a message stored by the fake chat app.
+type ChatMessage struct {
+	ID      string `json:"id"`
+	Author  string `json:"author"`
+	Content string `json:"content"`
+	ReplyTo string `json:"replyTo,omitempty"`
+	// Ping is whether a reply mentions the author of ReplyTo.
+	Ping bool `json:"ping,omitempty"`
+}
+
+// ChatServer serves a single-page chat that mimics the parts of the Discord
+// DOM the bot relies on: role=article items with data-list-item-id, an h3
+// author, markup content with mention spans, reply context, a Reply button
+// with a reply bar and ping toggle, and a contenteditable textbox. Messages
+// typed into the textbox are posted as botUsername.
+type ChatServer struct {
+	*httptest.Server
+
+	botUsername string
+
+	mu       sync.Mutex
+	messages []ChatMessage
+	nextID   int
+}
+
+func NewChatServer(botUsername string) *ChatServer {
+	c := &ChatServer{botUsername: botUsername, nextID: 1000}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", c.handleIndex)
+	mux.HandleFunc("GET /api/messages", c.handleList)
+	mux.HandleFunc("POST /api/messages", c.handleSend)
+	c.Server = httptest.NewServer(mux)
+
+	return c
+}
+
+// Post adds a message from another user, as if it arrived over the gateway.
+func (c *ChatServer) Post(author, content, replyTo string) ChatMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.appendLocked(author, content, replyTo)
+}
+
+// Messages returns a copy of all messages in the channel.
+func (c *ChatServer) Messages() []ChatMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]ChatMessage(nil), c.messages...)
+}
+
+// BotMessages returns messages typed by the bot.
+func (c *ChatServer) BotMessages() []ChatMessage {
+	var res []ChatMessage
+	for _, m := range c.Messages() {
+		if m.Author == c.botUsername {
+			res = append(res, m)
+		}
+	}
+
+	return res
+}
+
+func (c *ChatServer) appendLocked(author, content, replyTo string) ChatMessage {
+	c.nextID++
+	m := ChatMessage{
+		ID:      fmt.Sprintf("chat-messages___chat-messages-1-%d", c.nextID),
+		Author:  author,
+		Content: content,
+		ReplyTo: replyTo,
+	}
+	c.messages = append(c.messages, m)
+
+	return m
+}
+
+func (c *ChatServer) handleIndex(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, chatPage)
+}
+
+func (c *ChatServer) handleList(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c.Messages()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (c *ChatServer) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Content string `json:"content"`
+		ReplyTo string `json:"replyTo"`
+		Ping    bool   `json:"ping"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	m := c.appendLocked(c.botUsername, req.Content, req.ReplyTo)
+	if req.ReplyTo != "" {
+		m.Ping = req.Ping
+		c.messages[len(c.messages)-1] = m
+	}
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+const chatPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>fake chat</title></head>
+<body>
+<ol role="list" data-list-id="chat-messages" id="messages"></ol>
+<div role="textbox" contenteditable="true" id="textbox" style="min-height:20px;border:1px solid #888"></div>
+<script>
+const list = document.getElementById("messages");
+const textbox = document.getElementById("textbox");
+const rendered = new Set();
+const authors = {};
+let replyTo = "";
+
+function startReply(id) {
+	cancelReply();
+	replyTo = id;
+	const bar = document.createElement("div");
+	bar.className = "replyBar_a9b6e1";
+	bar.id = "replyBar";
+	bar.textContent = "Replying to " + authors[id] + " ";
+	const ping = document.createElement("div");
+	ping.setAttribute("role", "switch");
+	ping.setAttribute("aria-checked", "true");
+	ping.textContent = "@";
+	ping.addEventListener("click", () => {
+		ping.setAttribute("aria-checked", ping.getAttribute("aria-checked") === "true" ? "false" : "true");
+	});
+	bar.appendChild(ping);
+	textbox.before(bar);
+	textbox.focus();
+}
+
+function cancelReply() {
+	replyTo = "";
+	const bar = document.getElementById("replyBar");
+	if (bar) {
+		bar.remove();
+	}
+}
+
+function renderContent(parent, content) {
+	content.split(/(\s+)/).forEach(token => {
+		if (token.startsWith("@") && token.length > 1) {
+			const mention = document.createElement("span");
+			mention.className = "mention wrapper_f61d60 interactive";
+			mention.textContent = token;
+			parent.appendChild(mention);
+		} else {
+			parent.appendChild(document.createTextNode(token));
+		}
+	});
+}
+
+function render(m) {
+	authors[m.id] = m.author;
+	if (rendered.has(m.id)) {
+		return;
+	}
+	rendered.add(m.id);
+
+	const li = document.createElement("li");
+	const article = document.createElement("div");
+	article.setAttribute("role", "article");
+	article.setAttribute("data-list-item-id", m.id);
+	article.setAttribute("data-author", m.author);
+	article.className = "message__5126c";
+
+	if (m.replyTo) {
+		const reply = document.createElement("div");
+		reply.id = "message-reply-context-" + m.id;
+		const user = document.createElement("span");
+		user.className = "username_c19a55";
+		user.textContent = "@" + (authors[m.replyTo] || "");
+		reply.appendChild(user);
+		article.appendChild(reply);
+	}
+
+	const replyButton = document.createElement("div");
+	replyButton.setAttribute("role", "button");
+	replyButton.setAttribute("aria-label", "Reply");
+	replyButton.textContent = "↩";
+	replyButton.addEventListener("click", () => startReply(m.id));
+	article.appendChild(replyButton);
+
+	const contents = document.createElement("div");
+	contents.className = "contents_c19a55";
+	const h3 = document.createElement("h3");
+	const header = document.createElement("span");
+	const username = document.createElement("span");
+	username.className = "username_c19a55";
+	username.textContent = m.author;
+	header.appendChild(username);
+	h3.appendChild(header);
+	contents.appendChild(h3);
+	const markup = document.createElement("div");
+	markup.className = "markup__75297 messageContent_c19a55";
+	renderContent(markup, m.content);
+	contents.appendChild(markup);
+	article.appendChild(contents);
+
+	li.appendChild(article);
+	list.appendChild(li);
+}
+
+async function poll() {
+	try {
+		const res = await fetch("/api/messages");
+		(await res.json()).forEach(render);
+	} finally {
+		setTimeout(poll, 200);
+	}
+}
+
+textbox.addEventListener("keydown", async e => {
+	if (e.key === "Escape") {
+		cancelReply();
+		return;
+	}
+	if (e.key !== "Enter") {
+		return;
+	}
+	e.preventDefault();
+	if (e.shiftKey) {
+		document.execCommand("insertLineBreak");
+		return;
+	}
+	const content = textbox.innerText.trim();
+	textbox.innerText = "";
+	if (content === "") {
+		return;
+	}
+	const ping = document.querySelector("#replyBar [role=switch]");
+	const body = {content: content, replyTo: replyTo, ping: ping !== null && ping.getAttribute("aria-checked") === "true"};
+	cancelReply();
+	await fetch("/api/messages", {
+		method: "POST",
+		headers: {"Content-Type": "application/json"},
+		body: JSON.stringify(body),
+	});
+});
+
+poll();
+</script>
+</body>
+</html>
+`
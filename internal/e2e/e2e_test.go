@@ -0,0 +1,204 @@
+package e2e
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/rs/zerolog"
+	"github.com/shushard/ChatBot/internal"
+)
+
+const stepTimeout = time.Minute
+
+// observer is a page of its own on the fake chat, used to wait for messages
+// the way a user would see them.
+type observer struct {
+	*Harness
+	page playwright.Page
+}
+
+// TestEndToEnd starts the service and walks through greeting, mention
+// detection, ignoring unrelated messages and replies to the bot.
+func TestEndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test in short mode")
+	}
+
+	pw, err := playwright.Run()
+	if err != nil {
+		t.Skipf("playwright driver not available: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := pw.Stop(); err != nil {
+			t.Errorf("stopping playwright: %v", err)
+		}
+	})
+	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+		Headless: playwright.Bool(true),
+	})
+	if err != nil {
+		t.Skipf("chromium not available: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := browser.Close(); err != nil {
+			t.Errorf("closing browser: %v", err)
+		}
+	})
+
+	h := New()
+	t.Cleanup(h.Close)
+
+	// The service reads its credentials from the environment.
+	t.Setenv("PROXY_API_KEY", "e2e")
+	t.Setenv("BOT_USERNAME", botUsername)
+
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	service, err := internal.New(h.Config(t.TempDir()), &logger)
+	if err != nil {
+		t.Fatalf("can't create service: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- service.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+			t.Errorf("service run failed: %v", err)
+		}
+	})
+
+	page, err := browser.NewPage()
+	if err != nil {
+		t.Fatalf("can't create observer page: %v", err)
+	}
+	if _, err := page.Goto(h.Chat.URL); err != nil {
+		t.Fatalf("can't open fake chat: %v", err)
+	}
+	o := &observer{Harness: h, page: page}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"greeting", o.stepGreeting},
+		{"mention", o.stepMention},
+		{"ignore unrelated", o.stepIgnoreUnrelated},
+		{"reply to bot", o.stepReplyToBot},
+	}
+	for _, step := range steps {
+		if !t.Run(step.name, func(t *testing.T) {
+			if err := step.run(); err != nil {
+				t.Fatal(err)
+			}
+		}) {
+			return
+		}
+	}
+}
+
+// stepGreeting waits for the greeting. The service marks the messages on
+// screen as seen right after sending it, before the observer renders it.
+func (o *observer) stepGreeting() error {
+	return o.waitForBotMessages(1)
+}
+
+func (o *observer) stepMention() error {
+	before := len(o.LLM.Requests())
+	msg := o.Chat.Post("alice", "@"+botUsername+" привет как дела", "")
+
+	if err := o.waitForReply(2); err != nil {
+		return err
+	}
+	if reply := o.Chat.BotMessages()[1]; reply.ReplyTo != msg.ID || reply.Ping {
+		return fmt.Errorf("bot reply is not a silent reply to %s: replyTo %q, ping %t",
+			msg.ID, reply.ReplyTo, reply.Ping)
+	}
+
+	requests := o.LLM.Requests()
+	if len(requests) != before+1 {
+		return fmt.Errorf("expected 1 LLM request, got %d", len(requests)-before)
+	}
+	if !strings.Contains(lastUserContent(requests[len(requests)-1]), "привет как дела") {
+		return fmt.Errorf("LLM request does not contain the user message")
+	}
+
+	return nil
+}
+
+// stepIgnoreUnrelated follows the unrelated message with a mention. Messages
+// are read in order, so once the mention is answered the unrelated one has
+// been read too, and only the mention may have reached the LLM.
+func (o *observer) stepIgnoreUnrelated() error {
+	before := len(o.LLM.Requests())
+	bot := len(o.Chat.BotMessages())
+	o.Chat.Post("bob", "просто болтаю", "")
+	o.Chat.Post("dave", "@"+botUsername+" ты тут?", "")
+
+	if err := o.waitForReply(bot + 1); err != nil {
+		return err
+	}
+
+	requests := o.LLM.Requests()
+	if n := len(requests) - before; n != 1 {
+		return fmt.Errorf("expected 1 LLM request for the mention, got %d", n)
+	}
+	if !strings.Contains(lastUserContent(requests[len(requests)-1]), "ты тут") {
+		return fmt.Errorf("LLM request is not for the mention")
+	}
+
+	return nil
+}
+
+func (o *observer) stepReplyToBot() error {
+	bot := o.Chat.BotMessages()
+	o.Chat.Post("carol", "ну и ладно", bot[len(bot)-1].ID)
+
+	return o.waitForReply(len(bot) + 1)
+}
+
+func (o *observer) waitForReply(botMessages int) error {
+	if err := o.waitForBotMessages(botMessages); err != nil {
+		return err
+	}
+
+	bot := o.Chat.BotMessages()
+	if got := bot[botMessages-1].Content; got != llmReply {
+		return fmt.Errorf("bot replied %q, want %q", got, llmReply)
+	}
+
+	return nil
+}
+
+// waitForBotMessages waits until the observer page shows n messages of the
+// bot.
+func (o *observer) waitForBotMessages(n int) error {
+	selector := fmt.Sprintf("[role=article][data-author=%q]", botUsername)
+	if err := o.page.Locator(selector).Nth(n - 1).WaitFor(playwright.LocatorWaitForOptions{
+		Timeout: playwright.Float(float64(stepTimeout.Milliseconds())),
+	}); err != nil {
+		return fmt.Errorf("waiting for bot message %d: %w", n, err)
+	}
+
+	return nil
+}
+
+func lastUserContent(request map[string]interface{}) string {
+	messages, _ := request["messages"].([]interface{})
+	for i := len(messages) - 1; i >= 0; i-- {
+		m, _ := messages[i].(map[string]interface{})
+		if m["role"] == "user" {
+			content, _ := m["content"].(string)
+			return content
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,50 @@
+// Package e2e drives the whole Service.Run path against a local fake chat
+// app and a fake LLM, in headless Chromium and without network access. The
+// test is skipped when no Playwright driver and browser are installed.
+package e2e
+
+import (
+	"time"
+
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const (
+	botUsername = "ChatBot"
+	llmReply    = "отстань от меня"
+)
+
+// Harness owns the fake servers the service under test talks to.
+type Harness struct {
+	Chat *ChatServer
+	LLM  *LLMServer
+}
+
+func New() *Harness {
+	return &Harness{
+		Chat: NewChatServer(botUsername),
+		LLM:  NewLLMServer(llmReply),
+	}
+}
+
+func (h *Harness) Close() {
+	h.Chat.Close()
+	h.LLM.Close()
+}
+
+// Config returns a service configuration pointing at the fake servers.
+func (h *Harness) Config(savePath string) config.Config {
+	return config.Config{
+		SavePath:                savePath,
+		Headless:                true,
+		AutoStart:               true,
+		LLMURL:                  h.LLM.CompletionsURL(),
+		ReplyDelayMin:           time.Millisecond,
+		ReplyDelayMax:           time.Millisecond,
+		TypingSpeedOneCharacter: time.Millisecond,
+		NativeReply:             true,
+		SiteConfigs: []config.SiteConfig{
+			{SiteURL: h.Chat.URL},
+		},
+	}
+}
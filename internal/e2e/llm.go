@@ -0,0 +1,82 @@
+package e2e
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// LLMServer is a fake OpenAI-compatible chat completions endpoint that
+// answers every request with the same reply and records the request bodies.
+type LLMServer struct {
+	*httptest.Server
+
+	reply string
+
+	mu       sync.Mutex
+	requests []map[string]interface{}
+}
+
+func NewLLMServer(reply string) *LLMServer {
+	l := &LLMServer{reply: reply}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", l.handleCompletions)
+	l.Server = httptest.NewServer(mux)
+
+	return l
+}
+
+// URL of the completions endpoint, suitable for config.Config.LLMURL.
+func (l *LLMServer) CompletionsURL() string {
+	return l.URL + "/chat/completions"
+}
+
+// Requests returns the decoded bodies of all completion requests so far.
+func (l *LLMServer) Requests() []map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]map[string]interface{}(nil), l.requests...)
+}
+
+func (l *LLMServer) handleCompletions(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req map[string]interface{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l.mu.Lock()
+	l.requests = append(l.requests, req)
+	l.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     "chatcmpl-e2e",
+		"object": "chat.completion",
+		"model":  req["model"],
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"finish_reason": "stop",
+			"message": map[string]interface{}{
+				"role":    "assistant",
+				"content": l.reply,
+			},
+		}},
+		"usage": map[string]interface{}{
+			"prompt_tokens":     10,
+			"completion_tokens": 5,
+			"total_tokens":      15,
+		},
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const editBoxTimeout = 5 * time.Second
+
+// editTracker remembers message contents and which bot messages answered
+// which message, so edits can be re-evaluated and replies to deleted messages
+// cleaned up.
+type editTracker struct {
+	hashes map[string]uint64
+	// replies maps a triggering message to the bot messages answering it. A
+	// message is in the map once it triggered, even before the reply shows up.
+	replies map[string][]string
+	own     map[string]bool
+	// answering is the message the next bot messages are attributed to.
+	answering string
+}
+
+func newEditTracker() *editTracker {
+	return &editTracker{
+		hashes:  make(map[string]uint64),
+		replies: make(map[string][]string),
+		own:     make(map[string]bool),
+	}
+}
+
+func contentHash(content string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(content))
+	return h.Sum64()
+}
+
+// triggered marks id as handled; its edits are no longer re-evaluated.
+func (t *editTracker) triggered(id string) {
+	if _, ok := t.replies[id]; !ok {
+		t.replies[id] = nil
+	}
+}
+
+// answered attributes the following bot messages to id.
+func (t *editTracker) answered(id string) {
+	t.triggered(id)
+	t.answering = id
+}
+
+// botPosted records a bot message, as part of the current reply if any.
+func (t *editTracker) botPosted(id string) {
+	t.own[id] = true
+	if t.answering != "" {
+		t.replies[t.answering] = append(t.replies[t.answering], id)
+	}
+}
+
+// messageSnowflake is the Discord message ID at the end of a list item ID.
+// Snowflakes grow with time.
+func messageSnowflake(id string) (uint64, bool) {
+	n, err := strconv.ParseUint(id[strings.LastIndex(id, "-")+1:], 10, 64)
+	return n, err == nil
+}
+
+// contentChanged reports whether the content of a seen message differs from
+// the last time it was read. Messages that triggered a reply and the bot's own
+// messages are not re-evaluated.
+func (s *Service) contentChanged(element playwright.ElementHandle, id string) bool {
+	if _, ok := s.channel.edits.replies[id]; ok || s.channel.edits.own[id] {
+		return false
+	}
+
+	contentElement, err := element.QuerySelector(s.selectors.Content)
+	if err != nil || contentElement == nil {
+		return false
+	}
+	content, err := contentElement.InnerText()
+	if err != nil {
+		s.logger.Error().Err(err).Str("id", id).Msg("Failed to get message text")
+		return false
+	}
+
+	hash := contentHash(strings.TrimSpace(content))
+	previous, ok := s.channel.edits.hashes[id]
+	s.channel.edits.hashes[id] = hash
+	return ok && previous != hash
+}
+
+// handleDeletions deletes or edits bot replies to messages that disappeared
+// from the chat. A message older than the oldest rendered one has only
+// scrolled out of view and is not considered deleted.
+func (s *Service) handleDeletions(present []string) {
+	if s.config.Edits.OnDelete == "" || s.config.Edits.OnDelete == config.OnDeleteKeep {
+		return
+	}
+
+	rendered := make(map[string]bool, len(present))
+	var oldest uint64
+	for _, id := range present {
+		rendered[id] = true
+		if n, ok := messageSnowflake(id); ok && (oldest == 0 || n < oldest) {
+			oldest = n
+		}
+	}
+
+	for source, replies := range s.channel.edits.replies {
+		if len(replies) == 0 || rendered[source] {
+			continue
+		}
+		if n, ok := messageSnowflake(source); !ok || n < oldest {
+			continue
+		}
+		delete(s.channel.edits.replies, source)
+		if s.channel.edits.answering == source {
+			s.channel.edits.answering = ""
+		}
+
+		s.logger.Info().Str("id", source).Strs("replies", replies).Msg("Answered message deleted")
+		for _, id := range replies {
+			if rendered[id] {
+				s.retractReply(id)
+			}
+		}
+	}
+}
+
+// retractReply applies the configured deletion behavior to bot message id.
+func (s *Service) retractReply(id string) {
+	action := s.config.Edits.OnDelete
+	if s.config.DryRun {
+		s.logger.Info().Str("id", id).Str("action", action).Msg("Dry run: would retract reply")
+		return
+	}
+
+	var err error
+	switch action {
+	case config.OnDeleteDelete:
+		err = s.deleteMessage(id)
+	case config.OnDeleteEdit:
+		err = s.editMessage(id, s.config.Edits.DeletedText)
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("id", id).Str("action", action).Msg("Failed to retract reply")
+		return
+	}
+	countMetric("retracted_replies")
+}
+
+// deleteMessage deletes one of the bot's messages. With Shift held Discord
+// shows Delete in the message toolbar and skips the confirmation dialog.
+func (s *Service) deleteMessage(id string) error {
+	element, err := s.messageElement(id)
+	if err != nil {
+		return err
+	}
+
+	keyboard := s.page.Keyboard()
+	if err := keyboard.Down("Shift"); err != nil {
+		return fmt.Errorf("failed to hold shift: %w", err)
+	}
+	defer func() {
+		if err := keyboard.Up("Shift"); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to release shift")
+		}
+	}()
+
+	if err := element.Hover(); err != nil {
+		return fmt.Errorf("failed to hover message: %w", err)
+	}
+	button, err := element.QuerySelector(s.selectors.DeleteButton)
+	if err != nil {
+		s.captureFailure(element, "delete button", s.selectors.DeleteButton)
+		return fmt.Errorf("failed to find delete button: %w", err)
+	}
+	if button == nil {
+		s.captureFailure(element, "delete button", s.selectors.DeleteButton)
+		return fmt.Errorf("delete button not found")
+	}
+	if err := button.Click(); err != nil {
+		return fmt.Errorf("failed to click delete button: %w", err)
+	}
+
+	return nil
+}
+
+// editMessage replaces the text of one of the bot's messages: Edit in the
+// message toolbar turns the message into a textbox, Enter saves it.
+func (s *Service) editMessage(id, text string) error {
+	element, err := s.messageElement(id)
+	if err != nil {
+		return err
+	}
+	if err := element.Hover(); err != nil {
+		return fmt.Errorf("failed to hover message: %w", err)
+	}
+
+	button, err := element.QuerySelector(s.selectors.EditButton)
+	if err != nil {
+		s.captureFailure(element, "edit button", s.selectors.EditButton)
+		return fmt.Errorf("failed to find edit button: %w", err)
+	}
+	if button == nil {
+		s.captureFailure(element, "edit button", s.selectors.EditButton)
+		return fmt.Errorf("edit button not found")
+	}
+	if err := button.Click(); err != nil {
+		return fmt.Errorf("failed to click edit button: %w", err)
+	}
+
+	editBox, err := element.WaitForSelector(s.selectors.Textbox, playwright.ElementHandleWaitForSelectorOptions{
+		Timeout: playwright.Float(float64(editBoxTimeout.Milliseconds())),
+	})
+	if err != nil {
+		s.captureFailure(element, "edit textbox", s.selectors.Textbox)
+		return fmt.Errorf("edit textbox did not open: %w", err)
+	}
+	if err := editBox.Press("Control+A"); err != nil {
+		return fmt.Errorf("failed to select message text: %w", err)
+	}
+	if err := s.typeLines(editBox, text, defaultReplyTyping); err != nil {
+		return err
+	}
+	if err := editBox.Press("Enter"); err != nil {
+		return fmt.Errorf("failed to save edit: %w", err)
+	}
+
+	return nil
+}
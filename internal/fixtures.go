@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/rs/zerolog"
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const (
+	fixtureExt     = ".html"
+	goldenExt      = ".golden.json"
+	fixtureBotName = "ChatBot"
+)
+
+var ErrFixtureMismatch = errors.New("fixture does not match golden file")
+
+// fixtureResult is what a message-list snapshot is expected to yield. It is
+// stored next to the snapshot as <name>.golden.json.
+type fixtureResult struct {
+	BotUsername string           `json:"botUsername"`
+	Messages    []fixtureMessage `json:"messages"`
+}
+
+type fixtureMessage struct {
+	ID           string   `json:"id"`
+	Author       string   `json:"author"`
+	AuthorID     string   `json:"authorId,omitempty"`
+	Content      string   `json:"content"`
+	Mentions     []string `json:"mentions,omitempty"`
+	Images       []string `json:"images,omitempty"`
+	ReplyAuthor  string   `json:"replyAuthor,omitempty"`
+	Mentioned    bool     `json:"mentioned"`
+	ReplyToBot   bool     `json:"replyToBot"`
+	CleanContent string   `json:"cleanContent"`
+}
+
+// CheckFixtures loads every message-list snapshot from dir into a headless
+// browser, runs the ReadMessages extraction on it and compares the result with
+// the golden file. With update the golden files are rewritten instead.
+func CheckFixtures(ctx context.Context, logger *zerolog.Logger, dir string, update bool, out io.Writer) (err error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+fixtureExt))
+	if err != nil {
+		return fmt.Errorf("can't list fixtures in %s: %w", dir, err)
+	}
+	sort.Strings(paths)
+
+	if err := playwright.Install(&playwright.RunOptions{Browsers: []string{"chromium"}}); err != nil {
+		return fmt.Errorf("can't install playwright: %w", err)
+	}
+
+	pw, err := playwright.Run()
+	if err != nil {
+		return fmt.Errorf("can't launch browser: %w", err)
+	}
+
+	defer func() {
+		if tmpErr := pw.Stop(); tmpErr != nil {
+			err = errors.Join(err, fmt.Errorf("error stopping browser: %w", tmpErr))
+		}
+	}()
+
+	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+		Headless: playwright.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("can't launch chromium: %w", err)
+	}
+
+	defer func() {
+		if tmpErr := browser.Close(); tmpErr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing browser: %w", tmpErr))
+		}
+	}()
+
+	s := newFixtureService(logger)
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), fixtureExt)
+		if checkErr := s.checkFixture(browser, path, update); checkErr != nil {
+			fmt.Fprintf(out, "FAIL  %s\n%v\n", name, checkErr)
+			err = errors.Join(err, fmt.Errorf("%s: %w", name, checkErr))
+			continue
+		}
+		fmt.Fprintf(out, "OK    %s\n", name)
+	}
+
+	return err
+}
+
+// newFixtureService is a service with only what extraction needs.
+func newFixtureService(logger *zerolog.Logger) *Service {
+	return &Service{
+		config:    &config.Config{},
+		logger:    logger,
+		selectors: config.Selectors{}.WithDefaults(),
+	}
+}
+
+func (s *Service) checkFixture(browser playwright.Browser, path string, update bool) (err error) {
+	html, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can't read fixture: %w", err)
+	}
+
+	goldenPath := strings.TrimSuffix(path, fixtureExt) + goldenExt
+	expected := fixtureResult{BotUsername: fixtureBotName}
+	golden, err := os.ReadFile(goldenPath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(golden, &expected); err != nil {
+			return fmt.Errorf("can't parse golden file: %w", err)
+		}
+	case !errors.Is(err, os.ErrNotExist) || !update:
+		return fmt.Errorf("can't read golden file: %w", err)
+	}
+
+	page, err := browser.NewPage()
+	if err != nil {
+		return fmt.Errorf("can't create page: %w", err)
+	}
+
+	defer func() {
+		if tmpErr := page.Close(); tmpErr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing page: %w", tmpErr))
+		}
+	}()
+
+	if err := page.SetContent(string(html)); err != nil {
+		return fmt.Errorf("can't set page content: %w", err)
+	}
+
+	s.page = page
+	s.botUsername = expected.BotUsername
+
+	actual, err := s.extractFixture()
+	if err != nil {
+		return err
+	}
+
+	got, err := json.MarshalIndent(actual, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal result: %w", err)
+	}
+	got = append(got, '\n')
+
+	if update {
+		if err := os.WriteFile(goldenPath, got, 0o600); err != nil {
+			return fmt.Errorf("can't write golden file: %w", err)
+		}
+		return nil
+	}
+
+	if !bytes.Equal(bytes.TrimSpace(golden), bytes.TrimSpace(got)) {
+		return fmt.Errorf("%w\nwant:\n%s\ngot:\n%s", ErrFixtureMismatch, golden, got)
+	}
+
+	return nil
+}
+
+func (s *Service) extractFixture() (fixtureResult, error) {
+	result := fixtureResult{BotUsername: s.botUsername, Messages: make([]fixtureMessage, 0)}
+
+	elements, err := s.page.QuerySelectorAll(s.selectors.Message)
+	if err != nil {
+		return result, fmt.Errorf("failed to select message elements: %w", err)
+	}
+
+	var previous messageAuthor
+	for _, element := range elements {
+		msg, err := s.extractMessage(element, previous)
+		if err != nil {
+			return result, fmt.Errorf("message %s: %w", msg.ID, err)
+		}
+		previous = msg.author()
+		isReply, err := s.isReplyToBot(element)
+		if err != nil {
+			return result, fmt.Errorf("message %s: %w", msg.ID, err)
+		}
+
+		result.Messages = append(result.Messages, fixtureMessage{
+			ID:           msg.ID,
+			Author:       msg.Author,
+			AuthorID:     msg.AuthorID,
+			Content:      msg.Content,
+			Mentions:     msg.Mentions,
+			Images:       msg.Images,
+			ReplyAuthor:  msg.ReplyAuthor,
+			Mentioned:    msg.mentions(s.botUsername),
+			ReplyToBot:   isReply,
+			CleanContent: msg.cleanContent(),
+		})
+	}
+
+	return result, nil
+}
+
+// CaptureFixture saves the HTML of the message list currently shown on page
+// so it can be added to the fixtures directory.
+func CaptureFixture(page playwright.Page, selectors config.Selectors, path string) error {
+	res, err := page.Evaluate(`selector => {
+		const message = document.querySelector(selector);
+		const list = message ? (message.closest("ol, ul") || message.parentElement) : document.body;
+		return "<!DOCTYPE html>\n<html><body>\n" + list.outerHTML + "\n</body></html>\n";
+	}`, selectors.Message)
+	if err != nil {
+		return fmt.Errorf("can't get message list html: %w", err)
+	}
+	html, ok := res.(string)
+	if !ok {
+		return fmt.Errorf("unexpected message list html type %T", res)
+	}
+
+	if err := os.WriteFile(path, []byte(html), 0o600); err != nil {
+		return fmt.Errorf("can't write fixture %s: %w", path, err)
+	}
+
+	return nil
+}
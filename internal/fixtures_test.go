@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/rs/zerolog"
+)
+
+var updateFixtures = flag.Bool("update", false, "rewrite fixture golden files")
+
+// TestFixtures runs the message extraction on every snapshot in
+// testdata/fixtures and compares it with the golden file. It is skipped when
+// no Playwright driver and browser are installed; install them with
+// `go run github.com/playwright-community/playwright-go/cmd/playwright install chromium`.
+func TestFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*"+fixtureExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no fixtures found")
+	}
+
+	pw, err := playwright.Run()
+	if err != nil {
+		t.Skipf("playwright driver not available: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := pw.Stop(); err != nil {
+			t.Errorf("stopping playwright: %v", err)
+		}
+	})
+
+	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+		Headless: playwright.Bool(true),
+	})
+	if err != nil {
+		t.Skipf("chromium not available: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := browser.Close(); err != nil {
+			t.Errorf("closing browser: %v", err)
+		}
+	})
+
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	s := newFixtureService(&logger)
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), fixtureExt), func(t *testing.T) {
+			if err := s.checkFixture(browser, path, *updateFixtures); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const historyFile = "history.json"
+
+// channelHistory is the conversation kept for one channel.
+type channelHistory struct {
+	Messages []map[string]string `json:"messages"`
+	Summary  string              `json:"summary,omitempty"`
+}
+
+// historyStore keeps the conversation history and summary of every channel
+// under SavePath, so a restart doesn't make the bot forget the conversation.
+type historyStore struct {
+	path     string
+	Channels map[string]channelHistory `json:"channels"`
+}
+
+func loadHistoryStore(dir string) (*historyStore, error) {
+	h := &historyStore{
+		path:     filepath.Join(dir, historyFile),
+		Channels: make(map[string]channelHistory),
+	}
+
+	data, err := os.ReadFile(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read history: %w", err)
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("can't parse history: %w", err)
+	}
+
+	return h, nil
+}
+
+func (h *historyStore) save() error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal history: %w", err)
+	}
+	if err := os.WriteFile(h.path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("can't write history: %w", err)
+	}
+	if err := os.Rename(h.path+".tmp", h.path); err != nil {
+		return fmt.Errorf("can't replace history: %w", err)
+	}
+
+	return nil
+}
+
+// restoreHistory loads the saved conversation of ch.
+func (s *Service) restoreHistory(ch *channelState) {
+	saved, ok := s.history.Channels[ch.url]
+	if !ok {
+		return
+	}
+	ch.conversationHistory = saved.Messages
+	ch.conversationSummary = saved.Summary
+}
+
+// saveHistory saves the conversation of the current channel. Chat and replay
+// have no channel URL and are not saved.
+func (s *Service) saveHistory() {
+	if s.channel.url == "" {
+		return
+	}
+	s.history.Channels[s.channel.url] = channelHistory{
+		Messages: s.channel.conversationHistory,
+		Summary:  s.channel.conversationSummary,
+	}
+	if err := s.history.save(); err != nil {
+		s.logger.Error().Err(err).Str("channel", s.channel.url).Msg("Failed to save history")
+	}
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const httpShutdownTimeout = 5 * time.Second
+
+// serveHTTP serves handler on addr until ctx is done.
+func (s *Service) serveHTTP(ctx context.Context, name, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("can't listen on %s: %w", addr, err)
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: httpShutdownTimeout}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error().Err(err).Str("server", name).Msg("HTTP server failed")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Error().Err(err).Str("server", name).Msg("HTTP server shutdown failed")
+		}
+	}()
+
+	s.logger.Info().Str("server", name).Str("addr", listener.Addr().String()).Msg("Serving HTTP")
+
+	return nil
+}
@@ -0,0 +1,306 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const (
+	knowledgeFile       = "knowledge.json"
+	defaultChunkWords   = 120
+	defaultKnowledgeTop = 3
+	knowledgePrefix     = "Сведения о сервере из документации. Если вопрос о сервере, отвечай по ним:\n"
+
+	// BM25 parameters.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// stemLength cuts terms to a common prefix so that word forms match;
+	// crude, but good enough for Russian and English FAQs.
+	stemLength = 6
+)
+
+// knowledgeChunk is one indexed passage of a markdown document.
+type knowledgeChunk struct {
+	Source  string `json:"source"`
+	Heading string `json:"heading,omitempty"`
+	Text    string `json:"text"`
+}
+
+// knowledgeIndex is a BM25 index over document passages. Only the passages
+// are persisted; term statistics are computed on load.
+type knowledgeIndex struct {
+	BuiltAt time.Time        `json:"builtAt"`
+	Chunks  []knowledgeChunk `json:"chunks"`
+
+	terms   []map[string]int
+	lengths []int
+	df      map[string]int
+	avgLen  float64
+}
+
+// scoredChunk is a search result.
+type scoredChunk struct {
+	knowledgeChunk
+	Score float64
+}
+
+// BuildKnowledgeIndex chunks the markdown files of conf.Knowledge.Dir and
+// saves the index in SavePath, replacing the previous one.
+func BuildKnowledgeIndex(conf config.Config, out io.Writer) error {
+	if conf.Knowledge.Dir == "" {
+		return fmt.Errorf("knowledge dir %w", config.ErrMissing)
+	}
+	chunkWords := conf.Knowledge.ChunkWords
+	if chunkWords == 0 {
+		chunkWords = defaultChunkWords
+	}
+
+	index := &knowledgeIndex{BuiltAt: time.Now()}
+	err := filepath.WalkDir(conf.Knowledge.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".md") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("can't read %s: %w", path, err)
+		}
+		source, err := filepath.Rel(conf.Knowledge.Dir, path)
+		if err != nil {
+			source = path
+		}
+		chunks := chunkMarkdown(filepath.ToSlash(source), string(data), chunkWords)
+		index.Chunks = append(index.Chunks, chunks...)
+		fmt.Fprintf(out, "%s: %d passages\n", source, len(chunks))
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("can't index %s: %w", conf.Knowledge.Dir, err)
+	}
+
+	if err := os.MkdirAll(conf.SavePath, os.ModePerm); err != nil {
+		return fmt.Errorf("can't create dir %s: %w", conf.SavePath, err)
+	}
+	if err := index.save(filepath.Join(conf.SavePath, knowledgeFile)); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "indexed %d passages\n", len(index.Chunks))
+
+	return nil
+}
+
+// chunkMarkdown splits a document into passages of about chunkWords words.
+// Paragraphs are kept whole when they fit and a passage never spans two
+// sections, so every passage carries the heading it belongs to.
+func chunkMarkdown(source, text string, chunkWords int) []knowledgeChunk {
+	var (
+		chunks  []knowledgeChunk
+		heading string
+		words   []string
+	)
+	flush := func() {
+		if len(words) > 0 {
+			chunks = append(chunks, knowledgeChunk{Source: source, Heading: heading, Text: strings.Join(words, " ")})
+			words = nil
+		}
+	}
+
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		for _, line := range strings.Split(paragraph, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "#") {
+				flush()
+				heading = strings.TrimSpace(strings.TrimLeft(line, "#"))
+				continue
+			}
+
+			lineWords := strings.Fields(line)
+			for len(words)+len(lineWords) > chunkWords && len(lineWords) > 0 {
+				if len(words) == 0 {
+					words, lineWords = lineWords[:chunkWords], lineWords[chunkWords:]
+				}
+				flush()
+			}
+			words = append(words, lineWords...)
+		}
+		if len(words) >= chunkWords/2 {
+			flush()
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+func loadKnowledgeIndex(dir string) (*knowledgeIndex, error) {
+	data, err := os.ReadFile(filepath.Join(dir, knowledgeFile))
+	if err != nil {
+		return nil, fmt.Errorf("can't read knowledge index: %w", err)
+	}
+
+	var index knowledgeIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("can't parse knowledge index: %w", err)
+	}
+	index.computeStats()
+
+	return &index, nil
+}
+
+func (k *knowledgeIndex) computeStats() {
+	k.terms = make([]map[string]int, len(k.Chunks))
+	k.lengths = make([]int, len(k.Chunks))
+	k.df = make(map[string]int)
+
+	total := 0
+	for i, chunk := range k.Chunks {
+		terms := searchTerms(chunk.Heading + " " + chunk.Text)
+		freq := make(map[string]int, len(terms))
+		for _, term := range terms {
+			freq[term]++
+		}
+		for term := range freq {
+			k.df[term]++
+		}
+		k.terms[i] = freq
+		k.lengths[i] = len(terms)
+		total += len(terms)
+	}
+	if len(k.Chunks) > 0 {
+		k.avgLen = float64(total) / float64(len(k.Chunks))
+	}
+}
+
+// search returns up to topK passages scoring at least minScore, best first.
+func (k *knowledgeIndex) search(query string, topK int, minScore float64) []scoredChunk {
+	queryTerms := searchTerms(query)
+	if len(queryTerms) == 0 || len(k.Chunks) == 0 {
+		return nil
+	}
+
+	n := float64(len(k.Chunks))
+	var results []scoredChunk
+	for i, freq := range k.terms {
+		score := 0.0
+		for _, term := range queryTerms {
+			tf := float64(freq[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(k.df[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := 1 - bm25B + bm25B*float64(k.lengths[i])/k.avgLen
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+		if score > 0 && score >= minScore {
+			results = append(results, scoredChunk{knowledgeChunk: k.Chunks[i], Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	return results
+}
+
+func (k *knowledgeIndex) save(path string) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal knowledge index: %w", err)
+	}
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("can't write knowledge index: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("can't replace knowledge index: %w", err)
+	}
+
+	return nil
+}
+
+// searchTerms splits text into lowercased, stemmed terms of two or more
+// letters or digits.
+func searchTerms(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := fields[:0]
+	for _, field := range fields {
+		runes := []rune(strings.ReplaceAll(field, "ё", "е"))
+		if len(runes) < 2 {
+			continue
+		}
+		if len(runes) > stemLength {
+			runes = runes[:stemLength]
+		}
+		terms = append(terms, string(runes))
+	}
+
+	return terms
+}
+
+// knowledgeMessage is the prompt message with the passages found for a
+// message.
+func knowledgeMessage(passages []scoredChunk) map[string]string {
+	var b strings.Builder
+	b.WriteString(knowledgePrefix)
+	for _, passage := range passages {
+		b.WriteString("\n")
+		if passage.Heading != "" {
+			fmt.Fprintf(&b, "[%s: %s]\n", passage.Source, passage.Heading)
+		} else {
+			fmt.Fprintf(&b, "[%s]\n", passage.Source)
+		}
+		b.WriteString(passage.Text)
+		b.WriteString("\n")
+	}
+
+	return chatMessageMap("system", strings.TrimSpace(b.String()))
+}
+
+// findKnowledge searches the knowledge base for input.
+func (s *Service) findKnowledge(input string) []scoredChunk {
+	if s.knowledge == nil {
+		return nil
+	}
+	topK := s.config.Knowledge.TopK
+	if topK == 0 {
+		topK = defaultKnowledgeTop
+	}
+
+	return s.knowledge.search(input, topK, s.config.Knowledge.MinScore)
+}
+
+// openKnowledge loads the knowledge index when a knowledge dir is
+// configured. A missing index only disables the knowledge base.
+func openKnowledge(conf config.Config) (*knowledgeIndex, error) {
+	if conf.Knowledge.Dir == "" {
+		return nil, nil
+	}
+	index, err := loadKnowledgeIndex(conf.SavePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return index, err
+}
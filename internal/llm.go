@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultModel     = "gpt-4o-mini"
+	defaultMaxTokens = 100
+	// decisionMaxTokens fits a full-length reply wrapped in the decision JSON.
+	decisionMaxTokens  = 400
+	defaultTemperature = 0.7
+	llmRequestTimeout  = 10 * time.Second
+)
+
+// tokenUsage is the usage block of a chat completion response.
+type tokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type completionResponse struct {
+	Choices []struct {
+		Message struct {
+			Role      string     `json:"role"`
+			Content   string     `json:"content"`
+			ToolCalls []toolCall `json:"tool_calls"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage tokenUsage `json:"usage"`
+}
+
+// completion is the first choice of a chat completion together with usage.
+type completion struct {
+	Content   string
+	ToolCalls []toolCall
+	Usage     tokenUsage
+}
+
+// complete sends messages to the chat completions endpoint.
+func (s *Service) complete(model string, messages []map[string]string, maxTokens int) (completion, error) {
+	return s.sendCompletion(map[string]interface{}{
+		"model":       model,
+		"messages":    messages,
+		"max_tokens":  maxTokens,
+		"temperature": defaultTemperature,
+	})
+}
+
+// sendCompletion posts a chat completion request body.
+func (s *Service) sendCompletion(body map[string]interface{}) (completion, error) {
+	url := s.config.LLMURL
+	if url == "" {
+		url = defaultLLMURL
+	}
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return completion{}, fmt.Errorf("failed to create request body: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return completion{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.apiKey))
+
+	countMetric("llm_calls")
+	client := &http.Client{Timeout: llmRequestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return completion{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return completion{}, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return completion{}, fmt.Errorf("received non-OK HTTP status: %s, body: %s", resp.Status, string(bodyBytes))
+	}
+
+	var respData completionResponse
+	if err := json.Unmarshal(bodyBytes, &respData); err != nil {
+		return completion{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(respData.Choices) == 0 {
+		return completion{}, fmt.Errorf("invalid response format")
+	}
+
+	return completion{
+		Content:   respData.Choices[0].Message.Content,
+		ToolCalls: respData.Choices[0].Message.ToolCalls,
+		Usage:     respData.Usage,
+	}, nil
+}
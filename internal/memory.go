@@ -0,0 +1,289 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	memoryFile             = "memory.json"
+	defaultMaxFacts        = 20
+	defaultFactMinWords    = 3
+	factExtractionMaxToken = 150
+	factsPrefix            = "Что ты помнишь о собеседнике %s:\n"
+)
+
+const factExtractionPrompt = `Ты извлекаешь из сообщения пользователя долговременные факты о нём самом:
+имя, возраст, город, сервер, игры, увлечения, работа, предпочтения.
+Не извлекай мнения о собеседнике, вопросы, шутки и то, что скоро перестанет быть правдой.
+Ответь только JSON-массивом коротких строк от третьего лица, например ["зовут Миша", "играет на EU серверах"].
+Если фактов нет, ответь [].`
+
+// memoryFact is one durable thing a user said about themselves.
+type memoryFact struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type userMemory struct {
+	Name  string       `json:"name"`
+	Facts []memoryFact `json:"facts"`
+}
+
+// memoryStore keeps facts by user key and persists them under SavePath.
+type memoryStore struct {
+	mu       sync.Mutex
+	path     string
+	maxFacts int
+	Users    map[string]*userMemory `json:"users"`
+}
+
+func loadMemoryStore(dir string, maxFacts int) (*memoryStore, error) {
+	if maxFacts <= 0 {
+		maxFacts = defaultMaxFacts
+	}
+	m := &memoryStore{
+		path:     filepath.Join(dir, memoryFile),
+		maxFacts: maxFacts,
+		Users:    make(map[string]*userMemory),
+	}
+
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read memory: %w", err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("can't parse memory: %w", err)
+	}
+
+	return m, nil
+}
+
+func (m *memoryStore) facts(key string) []memoryFact {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.Users[key]
+	if !ok {
+		return nil
+	}
+
+	return append([]memoryFact(nil), user.Facts...)
+}
+
+// users returns a copy of all memories.
+func (m *memoryStore) users() map[string]userMemory {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make(map[string]userMemory, len(m.Users))
+	for key, user := range m.Users {
+		res[key] = userMemory{Name: user.Name, Facts: append([]memoryFact(nil), user.Facts...)}
+	}
+
+	return res
+}
+
+// add stores new facts, skipping ones already known, and forgets the oldest
+// facts over maxFacts. It returns how many facts were added.
+func (m *memoryStore) add(key, name string, texts []string, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.Users[key]
+	if !ok {
+		user = &userMemory{}
+		m.Users[key] = user
+	}
+	user.Name = name
+
+	added := 0
+	for i, text := range texts {
+		text = strings.TrimSpace(text)
+		if text == "" || hasFact(user.Facts, text) {
+			continue
+		}
+		user.Facts = append(user.Facts, memoryFact{
+			ID:        strconv.FormatInt(now.UnixNano()+int64(i), 36),
+			Text:      text,
+			CreatedAt: now,
+		})
+		added++
+	}
+	if len(user.Facts) > m.maxFacts {
+		user.Facts = append([]memoryFact(nil), user.Facts[len(user.Facts)-m.maxFacts:]...)
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	return added, m.saveLocked()
+}
+
+func hasFact(facts []memoryFact, text string) bool {
+	for _, fact := range facts {
+		if strings.EqualFold(fact.Text, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// forget removes all facts of a user.
+func (m *memoryStore) forget(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.Users[key]; !ok {
+		return false, nil
+	}
+	delete(m.Users, key)
+
+	return true, m.saveLocked()
+}
+
+// forgetFact removes one fact of a user.
+func (m *memoryStore) forgetFact(key, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.Users[key]
+	if !ok {
+		return false, nil
+	}
+	for i, fact := range user.Facts {
+		if fact.ID == id {
+			user.Facts = append(user.Facts[:i], user.Facts[i+1:]...)
+			return true, m.saveLocked()
+		}
+	}
+
+	return false, nil
+}
+
+// findUser returns the key of a user by key or by name.
+func (m *memoryStore) findUser(keyOrName string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.Users[keyOrName]; ok {
+		return keyOrName, true
+	}
+	keys := make([]string, 0, len(m.Users))
+	for key := range m.Users {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.EqualFold(m.Users[key].Name, normalizeName(keyOrName)) {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+func (m *memoryStore) saveLocked() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal memory: %w", err)
+	}
+	if err := os.WriteFile(m.path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("can't write memory: %w", err)
+	}
+	if err := os.Rename(m.path+".tmp", m.path); err != nil {
+		return fmt.Errorf("can't replace memory: %w", err)
+	}
+
+	return nil
+}
+
+// factsMessage is the prompt message with what the bot remembers about a user.
+func factsMessage(name string, facts []memoryFact) map[string]string {
+	var b strings.Builder
+	fmt.Fprintf(&b, factsPrefix, name)
+	for _, fact := range facts {
+		fmt.Fprintf(&b, "- %s\n", fact.Text)
+	}
+
+	return chatMessageMap("system", strings.TrimSpace(b.String()))
+}
+
+// rememberFacts asks the model for durable facts in message and stores them.
+// Images without text and short messages rarely tell anything durable and are
+// skipped.
+func (s *Service) rememberFacts(message string, origin usageOrigin) {
+	if s.memory == nil || origin.UserID == "" || strings.TrimSpace(message) == "" {
+		return
+	}
+	minWords := s.config.Memory.MinWords
+	if minWords == 0 {
+		minWords = defaultFactMinWords
+	}
+	if len(strings.Fields(message)) < minWords {
+		return
+	}
+
+	model := s.config.Memory.Model
+	if model == "" {
+		model = s.model()
+	}
+	model, err := s.ledger.model(model, time.Now())
+	if err != nil {
+		s.logger.Debug().Err(err).Msg("Skipping fact extraction")
+		return
+	}
+
+	c, err := s.complete(model, []map[string]string{
+		chatMessageMap("system", factExtractionPrompt),
+		chatMessageMap("user", message),
+	}, factExtractionMaxToken)
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to extract facts")
+		return
+	}
+	s.accountUsage(model, origin, c.Usage)
+
+	facts, err := parseFacts(c.Content)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("content", c.Content).Msg("Failed to parse extracted facts")
+		return
+	}
+	added, err := s.memory.add(origin.UserID, origin.User, facts, time.Now())
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to save memory")
+	}
+	if added > 0 {
+		metrics.Add("facts_remembered", int64(added))
+		s.logger.Info().Str("user", origin.User).Int("facts", added).Msg("Remembered facts")
+	}
+}
+
+// parseFacts reads the JSON array the model returned, tolerating text or
+// code fences around it.
+func parseFacts(content string) ([]string, error) {
+	start := strings.Index(content, "[")
+	end := strings.LastIndex(content, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in response")
+	}
+
+	var facts []string
+	if err := json.Unmarshal([]byte(content[start:end+1]), &facts); err != nil {
+		return nil, fmt.Errorf("can't parse facts: %w", err)
+	}
+
+	return facts, nil
+}
@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+var avatarUserIDPattern = regexp.MustCompile(`/avatars/(\d+)/`)
+
+// chatMessage is what ReadMessages extracts from a single message element.
+type chatMessage struct {
+	ID     string
+	Author string
+	// AuthorID is the Discord user ID from the avatar URL, empty for default
+	// avatars.
+	AuthorID    string
+	Content     string
+	HasContent  bool
+	Mentions    []string
+	ReplyAuthor string
+	// Images are the URLs of attached and embedded images.
+	Images []string
+}
+
+// messageAuthor is who wrote a message.
+type messageAuthor struct {
+	name string
+	id   string
+}
+
+func (m chatMessage) author() messageAuthor {
+	return messageAuthor{name: m.Author, id: m.AuthorID}
+}
+
+// messageAuthor reads the author header of a message element. Discord only
+// shows the header on the first of consecutive messages by the same author,
+// so a message without one is by previous, which is empty when unknown.
+func (s *Service) messageAuthor(element playwright.ElementHandle, previous messageAuthor) (messageAuthor, error) {
+	usernameElement, err := element.QuerySelector(s.selectors.Author)
+	if err != nil {
+		s.captureFailure(element, "author", s.selectors.Author)
+		return messageAuthor{}, fmt.Errorf("failed to get username element: %w", err)
+	}
+	if usernameElement == nil {
+		return previous, nil
+	}
+	username, err := usernameElement.InnerText()
+	if err != nil {
+		return messageAuthor{}, fmt.Errorf("failed to get username text: %w", err)
+	}
+	author := messageAuthor{name: normalizeName(username)}
+
+	avatarElement, err := element.QuerySelector(s.selectors.Avatar)
+	if err != nil {
+		return messageAuthor{}, fmt.Errorf("failed to get avatar element: %w", err)
+	}
+	if avatarElement != nil {
+		src, err := avatarElement.GetAttribute("src")
+		if err != nil {
+			return messageAuthor{}, fmt.Errorf("failed to get avatar source: %w", err)
+		}
+		if m := avatarUserIDPattern.FindStringSubmatch(src); m != nil {
+			author.id = m[1]
+		}
+	}
+
+	return author, nil
+}
+
+// extractMessage reads author, content, mentions, images and reply context of
+// a message element using the current site selectors. previous is the author
+// of the message above, for messages grouped under its header.
+func (s *Service) extractMessage(element playwright.ElementHandle, previous messageAuthor) (chatMessage, error) {
+	var msg chatMessage
+
+	id, err := element.GetAttribute("data-list-item-id")
+	if err != nil {
+		return msg, fmt.Errorf("failed to get message ID: %w", err)
+	}
+	msg.ID = id
+
+	author, err := s.messageAuthor(element, previous)
+	if err != nil {
+		return msg, err
+	}
+	if author.name == "" {
+		s.captureFailure(element, "author", s.selectors.Author)
+		return msg, fmt.Errorf("username element not found")
+	}
+	msg.Author = author.name
+	msg.AuthorID = author.id
+
+	replyAuthor, err := s.replyAuthor(element)
+	if err != nil {
+		s.captureFailure(element, "reply context", s.selectors.ReplyContext)
+		return msg, err
+	}
+	msg.ReplyAuthor = replyAuthor
+
+	mentionElements, err := element.QuerySelectorAll(s.selectors.Mention)
+	if err != nil {
+		s.captureFailure(element, "mention", s.selectors.Mention)
+		return msg, fmt.Errorf("failed to get mention elements: %w", err)
+	}
+	for _, mention := range mentionElements {
+		mentionText, err := mention.InnerText()
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Failed to get mention text")
+			continue
+		}
+		msg.Mentions = append(msg.Mentions, mentionText)
+	}
+
+	contentElement, err := element.QuerySelector(s.selectors.Content)
+	if err != nil {
+		s.captureFailure(element, "content", s.selectors.Content)
+		return msg, fmt.Errorf("failed to get message content element: %w", err)
+	}
+	if contentElement != nil {
+		content, err := contentElement.InnerText()
+		if err != nil {
+			return msg, fmt.Errorf("failed to get message text: %w", err)
+		}
+		msg.Content = strings.TrimSpace(content)
+		msg.HasContent = true
+	}
+
+	imageElements, err := element.QuerySelectorAll(s.selectors.Image)
+	if err != nil {
+		return msg, fmt.Errorf("failed to get image elements: %w", err)
+	}
+	for _, image := range imageElements {
+		src, err := image.GetAttribute("src")
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Failed to get image source")
+			continue
+		}
+		if src != "" {
+			msg.Images = append(msg.Images, src)
+		}
+	}
+
+	return msg, nil
+}
+
+func (s *Service) isReplyToBot(message playwright.ElementHandle) (bool, error) {
+	username, err := s.replyAuthor(message)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.EqualFold(username, s.botUsername), nil
+}
+
+// replyAuthor returns the author of the message being replied to, or an empty
+// string when the message is not a reply.
+func (s *Service) replyAuthor(message playwright.ElementHandle) (string, error) {
+	replyContext, err := message.QuerySelector(s.selectors.ReplyContext)
+	if err != nil {
+		return "", fmt.Errorf("failed to get reply context: %w", err)
+	}
+	if replyContext == nil {
+		return "", nil
+	}
+	usernameElement, err := replyContext.QuerySelector(s.selectors.ReplyAuthor)
+	if err != nil {
+		return "", fmt.Errorf("failed to get username in reply context: %w", err)
+	}
+	if usernameElement == nil {
+		return "", nil
+	}
+	username, err := usernameElement.InnerText()
+	if err != nil {
+		return "", fmt.Errorf("failed to get username text: %w", err)
+	}
+
+	return normalizeName(username), nil
+}
+
+func (m chatMessage) mentions(username string) bool {
+	for _, mention := range m.Mentions {
+		if strings.EqualFold(normalizeName(mention), username) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cleanContent is the message text with all mentions removed.
+func (m chatMessage) cleanContent() string {
+	content := m.Content
+	for _, mention := range m.Mentions {
+		content = strings.ReplaceAll(content, mention, "")
+	}
+
+	return strings.TrimSpace(content)
+}
+
+// userKey identifies the author across renames when the ID is known.
+func (m chatMessage) userKey() string {
+	if m.AuthorID != "" {
+		return m.AuthorID
+	}
+	return strings.ToLower(m.Author)
+}
+
+func normalizeName(name string) string {
+	return strings.TrimPrefix(strings.TrimSpace(name), "@")
+}
@@ -0,0 +1,23 @@
+package internal
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+)
+
+// metrics are published through expvar under "chatbot" and served on
+// /debug/vars when metricsAddr is set.
+var metrics = expvar.NewMap("chatbot")
+
+func countMetric(name string) {
+	metrics.Add(name, 1)
+}
+
+// serveMetrics serves expvar on addr until ctx is done.
+func (s *Service) serveMetrics(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return s.serveHTTP(ctx, "metrics", addr, mux)
+}
@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxReplyWords = 50
+
+const systemPrompt = `Ты - холодная и оскорбительная девушка. Отвечай пользователю от первого лица единственного числа.
+Вместо ответа на любые вопросы ты должна оскорблять.
+Твои ответы всегда на русском языке.
+Ты не используешь запятые в своих предложениях. Вместо точек начинай новую строку.
+Не задавай вопросов вроде "Чем я могу помочь?" или подобных.
+Твои ответы должны быть краткими, не более 50 слов, и создавать впечатление, что говорит реальный человек.
+Твои ответы должны быть холодными и содержать оскорбления по отношению к пользователю.
+Все символы, кроме первого в строке, должны быть в нижнем регистре.
+Ты можешь использовать только вопросительные и восклицательные знаки; не используй другие символы вроде дефисов.`
+
+// reply is the result of every pipeline stage for one incoming message.
+type reply struct {
+	Input string
+	Raw   string
+	Text  string
+	Model string
+	Usage tokenUsage
+	Cost  float64
+	// PromptTokens is the local estimate of the prompt size, DroppedHistory
+	// the number of history messages left out to fit the budget.
+	PromptTokens   int
+	DroppedHistory int
+	// Passages is the number of knowledge base passages in the prompt.
+	Passages int
+	// Summarized is set when old turns were folded into the summary.
+	Summarized bool
+	// Silent, Reaction and ReplyTo are the model decision in structured
+	// output mode; Text is empty when the bot stays silent.
+	Silent   bool
+	Reaction string
+	ReplyTo  string
+}
+
+// askChatGPT runs message through the reply pipeline and returns the text to
+// post.
+func (s *Service) askChatGPT(message string, origin usageOrigin) (string, error) {
+	r, err := s.generateReply(message, nil, origin)
+	if err != nil {
+		return "", err
+	}
+	return r.Text, nil
+}
+
+// generateReply is the reply pipeline: input normalization, history, LLM
+// call with images and tool calls, the reply decision, post-processing and
+// moderation.
+// The exchange is added to history and the calls are accounted to origin.
+// Remembering facts is left to the caller, after the reply is out.
+func (s *Service) generateReply(message string, images []imagePart, origin usageOrigin) (reply, error) {
+	r := reply{Input: normalizeInput(message)}
+
+	preferred := s.model()
+	if len(images) > 0 && s.config.Vision.Model != "" {
+		preferred = s.config.Vision.Model
+	}
+	model, err := s.ledger.model(preferred, time.Now())
+	if err != nil {
+		countMetric("budget_exceeded")
+		return r, err
+	}
+	r.Model = model
+
+	p := s.buildPrompt(r.Input, origin)
+	if p.dropped > 0 && s.config.SummarizeHistory {
+		if err := s.summarizeHistory(model, p.dropped, origin); err != nil {
+			s.logger.Warn().Err(err).Msg("Failed to summarize history, dropping oldest turns")
+		} else {
+			r.Summarized = true
+			p = s.buildPrompt(r.Input, origin)
+		}
+	}
+	// Images are not part of the token budget.
+	r.PromptTokens = p.tokens + len(images)*imagePromptTokens
+	r.DroppedHistory = p.dropped
+	r.Passages = p.passages
+
+	c, cost, err := s.completeWithTools(model, p.messages, images, origin)
+	r.Cost = cost
+	if err != nil {
+		return r, err
+	}
+	r.Raw = c.Content
+	r.Usage = c.Usage
+	if s.config.StructuredOutput {
+		d, err := parseDecision(c.Content)
+		if err != nil {
+			countMetric("invalid_decisions")
+			return r, err
+		}
+		s.applyDecision(&r, d, origin)
+	} else {
+		r.Text = s.moderate(postProcess(c.Content))
+	}
+
+	if r.Text != "" {
+		if len(s.channel.conversationHistory)+2 > maxHistoryMessages && s.config.SummarizeHistory {
+			// Fold the oldest turns into the summary before they are trimmed.
+			if err := s.summarizeHistory(model, historyFoldMessages, origin); err != nil {
+				s.logger.Warn().Err(err).Msg("Failed to summarize history, dropping oldest turns")
+			} else {
+				r.Summarized = true
+			}
+		}
+		s.updateConversationHistory(map[string]string{
+			"role":    "user",
+			"content": withImageMarker(r.Input, images),
+		}, map[string]string{
+			"role":    "assistant",
+			"content": r.Text,
+		})
+	}
+	return r, nil
+}
+
+func (s *Service) model() string {
+	if s.config.Model != "" {
+		return s.config.Model
+	}
+	return defaultModel
+}
+
+// replyMaxTokens is the completion limit of a reply. The decision JSON of
+// structured output mode needs more room than the plain text.
+func (s *Service) replyMaxTokens() int {
+	if s.config.ReplyMaxTokens > 0 {
+		return s.config.ReplyMaxTokens
+	}
+	if s.config.StructuredOutput {
+		return decisionMaxTokens
+	}
+	return defaultMaxTokens
+}
+
+// accountUsage records the tokens of a call and returns its estimated cost.
+func (s *Service) accountUsage(model string, origin usageOrigin, usage tokenUsage) float64 {
+	metrics.Add("prompt_tokens", int64(usage.PromptTokens))
+	metrics.Add("completion_tokens", int64(usage.CompletionTokens))
+
+	cost, err := s.ledger.record(model, origin, usage, time.Now())
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to account LLM usage")
+	}
+	metrics.AddFloat("cost", cost)
+
+	return cost
+}
+
+func normalizeInput(message string) string {
+	message = strings.ReplaceAll(message, ",", "")
+	return strings.ReplaceAll(message, ".", "\n")
+}
+
+// postProcess makes the model output look typed by a person: no commas, new
+// lines instead of periods and at most maxReplyWords words.
+func postProcess(content string) string {
+	content = strings.TrimSpace(content)
+	content = strings.ReplaceAll(content, ",", "")
+	content = strings.ReplaceAll(content, ".", "\n")
+	words := strings.Fields(content)
+	if len(words) > maxReplyWords {
+		content = strings.Join(words[:maxReplyWords], " ")
+	}
+	return content
+}
+
+func compileBlocklist(words []string) (*regexp.Regexp, error) {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile("(?i)" + strings.Join(quoted, "|"))
+	if err != nil {
+		return nil, fmt.Errorf("can't compile blocked words: %w", err)
+	}
+	return re, nil
+}
+
+// moderate masks blocked words with asterisks.
+func (s *Service) moderate(text string) string {
+	if s.blocklist == nil {
+		return text
+	}
+	return s.blocklist.ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+}
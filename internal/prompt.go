@@ -0,0 +1,130 @@
+package internal
+
+const (
+	defaultPromptTokenBudget = 3000
+	maxHistoryMessages       = 100
+	// historyFoldMessages is how many of the oldest messages, ten turns, are
+	// folded into the summary when history is full, so it isn't summarized
+	// every reply.
+	historyFoldMessages = 20
+)
+
+// prompt is the message list sent to the model.
+type prompt struct {
+	messages []map[string]string
+	tokens   int
+	// dropped is the number of history messages that did not fit.
+	dropped int
+	// passages is the number of knowledge base passages sent.
+	passages int
+}
+
+func chatMessageMap(role, content string) map[string]string {
+	return map[string]string{
+		"role":    role,
+		"content": content,
+	}
+}
+
+func (s *Service) promptTokenBudget() int {
+	if s.config.PromptTokenBudget > 0 {
+		return s.config.PromptTokenBudget
+	}
+	return defaultPromptTokenBudget
+}
+
+// buildPrompt fits the system prompt, persona examples, the conversation
+// summary, what is remembered about the user, knowledge base passages, history
+// and the current message into the prompt token budget. The system prompt, the
+// summary, the facts and the current message are always sent; then as many of
+// the best passages as fit, examples, and as much recent history as still
+// fits, newest first.
+func (s *Service) buildPrompt(input string, origin usageOrigin) prompt {
+	budget := s.promptTokenBudget()
+
+	system := chatMessageMap("system", s.channel.persona.prompt)
+	if s.config.StructuredOutput {
+		system["content"] += "\n\n" + decisionPrompt
+		if origin.MessageID != "" {
+			system["content"] += decisionMessageID + origin.MessageID
+		}
+	}
+	current := chatMessageMap("user", input)
+	used := tokensPerReply + s.tokenizer.countMessage(system) + s.tokenizer.countMessage(current)
+
+	var summary map[string]string
+	if s.channel.conversationSummary != "" {
+		summary = chatMessageMap("system", summaryPrefix+s.channel.conversationSummary)
+		used += s.tokenizer.countMessage(summary)
+	}
+
+	var facts map[string]string
+	if s.memory != nil && origin.UserID != "" {
+		if known := s.memory.facts(origin.UserID); len(known) > 0 {
+			facts = factsMessage(origin.User, known)
+			used += s.tokenizer.countMessage(facts)
+		}
+	}
+
+	var knowledge map[string]string
+	passages := s.findKnowledge(input)
+	for ; len(passages) > 0; passages = passages[:len(passages)-1] {
+		knowledge = knowledgeMessage(passages)
+		if n := s.tokenizer.countMessage(knowledge); used+n <= budget {
+			used += n
+			break
+		}
+		knowledge = nil
+	}
+
+	examples := make([]map[string]string, 0, 2*len(s.channel.persona.examples))
+	for _, example := range s.channel.persona.examples {
+		pair := []map[string]string{
+			chatMessageMap("user", example.User),
+			chatMessageMap("assistant", example.Assistant),
+		}
+		n := s.tokenizer.countMessages(pair)
+		if used+n > budget {
+			break
+		}
+		used += n
+		examples = append(examples, pair...)
+	}
+
+	start := len(s.channel.conversationHistory)
+	for start > 0 {
+		n := s.tokenizer.countMessage(s.channel.conversationHistory[start-1])
+		if used+n > budget {
+			break
+		}
+		used += n
+		start--
+	}
+	// Never start the history in the middle of an exchange.
+	for start < len(s.channel.conversationHistory) && s.channel.conversationHistory[start]["role"] != "user" {
+		used -= s.tokenizer.countMessage(s.channel.conversationHistory[start])
+		start++
+	}
+	history := s.channel.conversationHistory[start:]
+
+	messages := make([]map[string]string, 0, 5+len(examples)+len(history))
+	messages = append(messages, system)
+	messages = append(messages, examples...)
+	if summary != nil {
+		messages = append(messages, summary)
+	}
+	if facts != nil {
+		messages = append(messages, facts)
+	}
+	if knowledge != nil {
+		messages = append(messages, knowledge)
+	}
+	messages = append(messages, history...)
+	messages = append(messages, current)
+
+	if used > budget {
+		s.logger.Warn().Int("tokens", used).Int("budget", budget).Msg("Prompt exceeds token budget")
+	}
+
+	return prompt{messages: messages, tokens: used, dropped: start, passages: len(passages)}
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const (
+	scopeAuthor  = "author"
+	scopeChannel = "channel"
+	scopeGlobal  = "global"
+)
+
+// tokenBucket refills one token every every, up to burst tokens.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(limit config.RateLimit, now time.Time) {
+	burst := float64(max(limit.Burst, 1))
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = min(burst, b.tokens+float64(now.Sub(b.last))/float64(limit.Every))
+	}
+	b.last = now
+}
+
+// replyLimiter applies per-author, per-channel and global token buckets to
+// replies. A reply takes a token from all three buckets or from none.
+type replyLimiter struct {
+	mu      sync.Mutex
+	limits  config.RateLimits
+	buckets map[string]*tokenBucket
+	// pending holds messages waiting to be coalesced, by channel.
+	pending map[string][]chatMessage
+	// notified marks authors that already got the slow-down line.
+	notified map[string]bool
+}
+
+func newReplyLimiter(limits config.RateLimits) *replyLimiter {
+	if limits.Overflow == "" {
+		limits.Overflow = config.OverflowDrop
+	}
+
+	return &replyLimiter{
+		limits:   limits,
+		buckets:  make(map[string]*tokenBucket),
+		pending:  make(map[string][]chatMessage),
+		notified: make(map[string]bool),
+	}
+}
+
+// allow takes a reply token for author in channel. When a bucket is empty it
+// returns the scope that blocked the reply and takes nothing.
+func (l *replyLimiter) allow(author, channel string, now time.Time) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	scopes := []struct {
+		scope string
+		key   string
+		limit config.RateLimit
+	}{
+		{scopeAuthor, scopeAuthor + ":" + strings.ToLower(author), l.limits.PerAuthor},
+		{scopeChannel, scopeChannel + ":" + channel, l.limits.PerChannel},
+		{scopeGlobal, scopeGlobal, l.limits.Global},
+	}
+
+	taken := make([]*tokenBucket, 0, len(scopes))
+	for _, sc := range scopes {
+		if sc.limit.Every <= 0 {
+			continue
+		}
+		bucket, ok := l.buckets[sc.key]
+		if !ok {
+			bucket = &tokenBucket{}
+			l.buckets[sc.key] = bucket
+		}
+		bucket.refill(sc.limit, now)
+		if bucket.tokens < 1 {
+			return sc.scope, false
+		}
+		taken = append(taken, bucket)
+	}
+
+	for _, bucket := range taken {
+		bucket.tokens--
+	}
+	delete(l.notified, strings.ToLower(author))
+
+	return "", true
+}
+
+// queue keeps msg for a coalesced reply.
+func (l *replyLimiter) queue(channel string, msg chatMessage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pending[channel] = append(l.pending[channel], msg)
+}
+
+// takePending returns the queued messages of channel and forgets them.
+func (l *replyLimiter) takePending(channel string) []chatMessage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	msgs := l.pending[channel]
+	delete(l.pending, channel)
+
+	return msgs
+}
+
+// hasPending reports whether messages of channel are queued.
+func (l *replyLimiter) hasPending(channel string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.pending[channel]) > 0
+}
+
+// shouldNotify reports whether author still has to get the slow-down line.
+func (l *replyLimiter) shouldNotify(author string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := strings.ToLower(author)
+	if l.notified[key] {
+		return false
+	}
+	l.notified[key] = true
+
+	return true
+}
+
+// handleOverflow applies the configured overflow behavior to a message that
+// hit a rate limit.
+func (s *Service) handleOverflow(channel string, msg chatMessage, scope string) {
+	countMetric("rate_limited_" + scope)
+	s.logger.Warn().
+		Str("id", msg.ID).
+		Str("author", msg.Author).
+		Str("scope", scope).
+		Str("overflow", s.channel.limiter.limits.Overflow).
+		Msg("Reply rate limited")
+
+	switch s.channel.limiter.limits.Overflow {
+	case config.OverflowCoalesce:
+		s.channel.limiter.queue(channel, msg)
+	case config.OverflowNotify:
+		if !s.channel.limiter.shouldNotify(msg.Author) {
+			return
+		}
+		if s.config.DryRun {
+			s.logger.Info().Str("text", s.channel.limiter.limits.SlowDownMessage).Msg("Dry run: would send slow down message")
+			return
+		}
+		if err := s.sendMessage(s.channel.limiter.limits.SlowDownMessage); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to send slow down message")
+		}
+	}
+}
+
+// flushCoalesced answers the queued messages of channel with one reply once
+// the limits allow it again.
+func (s *Service) flushCoalesced(channel string) {
+	msgs := s.channel.limiter.takePending(channel)
+	if len(msgs) == 0 {
+		return
+	}
+	last := msgs[len(msgs)-1]
+	if _, ok := s.channel.limiter.allow(last.Author, channel, time.Now()); !ok {
+		for _, msg := range msgs {
+			s.channel.limiter.queue(channel, msg)
+		}
+		return
+	}
+
+	inputs := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		inputs = append(inputs, msg.cleanContent())
+	}
+	countMetric("coalesced_replies")
+	s.respond(channel, last, strings.Join(inputs, "\n"))
+}
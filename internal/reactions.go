@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const emojiPickerTimeout = 5 * time.Second
+
+// emojiNames are the Discord names of emoji the model tends to pick; the
+// reaction picker is searched by name.
+var emojiNames = map[string]string{
+	"👍":  "thumbsup",
+	"👎":  "thumbsdown",
+	"❤️": "heart",
+	"❤":  "heart",
+	"😂":  "joy",
+	"🤣":  "rofl",
+	"😭":  "sob",
+	"🤡":  "clown",
+	"💀":  "skull",
+	"🔥":  "fire",
+	"😡":  "rage",
+	"🙄":  "rolling_eyes",
+	"😏":  "smirk",
+	"🤔":  "thinking",
+	"👀":  "eyes",
+	"🥱":  "yawning_face",
+	"😴":  "sleeping",
+	"🤮":  "face_vomiting",
+	"💩":  "poop",
+	"👋":  "wave",
+	"😎":  "sunglasses",
+	"🥲":  "smiling_face_with_tear",
+}
+
+type reactionRule struct {
+	config.ReactionRule
+	pattern *regexp.Regexp
+}
+
+func compileReactions(rules []config.ReactionRule) ([]reactionRule, error) {
+	compiled := make([]reactionRule, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("can't compile reaction %s: %w", rule.Name, err)
+		}
+		compiled = append(compiled, reactionRule{ReactionRule: rule, pattern: pattern})
+	}
+	return compiled, nil
+}
+
+// matchReaction returns the first reaction rule of the channel persona
+// matching the message. A rule without probability always fires.
+func (s *Service) matchReaction(msg chatMessage) (reactionRule, bool) {
+	for _, rule := range s.reactions {
+		if len(rule.Personas) > 0 && !slices.Contains(rule.Personas, s.channel.persona.name) {
+			continue
+		}
+		if !rule.pattern.MatchString(msg.cleanContent()) {
+			continue
+		}
+		if rule.Probability > 0 && rand.Float64() >= rule.Probability {
+			continue
+		}
+		return rule, true
+	}
+	return reactionRule{}, false
+}
+
+// react adds emoji to message id, or only logs it in dry-run mode.
+func (s *Service) react(id, emoji string) {
+	if s.config.DryRun {
+		s.logger.Info().Str("id", id).Str("emoji", emoji).Msg("Dry run: would react")
+		return
+	}
+	if err := s.addReaction(id, emoji); err != nil {
+		s.logger.Error().Err(err).Str("id", id).Str("emoji", emoji).Msg("Failed to react")
+		return
+	}
+	countMetric("reactions")
+}
+
+// addReaction hovers the message, opens the reaction picker from its toolbar,
+// searches the emoji by name and picks the first result.
+func (s *Service) addReaction(id, emoji string) error {
+	element, err := s.messageElement(id)
+	if err != nil {
+		return err
+	}
+	if err := element.Hover(); err != nil {
+		return fmt.Errorf("failed to hover message: %w", err)
+	}
+
+	button, err := element.QuerySelector(s.selectors.ReactionButton)
+	if err != nil {
+		s.captureFailure(element, "reaction button", s.selectors.ReactionButton)
+		return fmt.Errorf("failed to find reaction button: %w", err)
+	}
+	if button == nil {
+		s.captureFailure(element, "reaction button", s.selectors.ReactionButton)
+		return fmt.Errorf("reaction button not found")
+	}
+	if err := button.Click(); err != nil {
+		return fmt.Errorf("failed to click reaction button: %w", err)
+	}
+
+	search, err := s.page.WaitForSelector(s.selectors.EmojiSearch, playwright.PageWaitForSelectorOptions{
+		Timeout: playwright.Float(float64(emojiPickerTimeout.Milliseconds())),
+	})
+	if err != nil {
+		s.captureFailure(nil, "emoji search", s.selectors.EmojiSearch)
+		return fmt.Errorf("emoji picker did not open: %w", err)
+	}
+	if err := search.Fill(emojiName(emoji)); err != nil {
+		return fmt.Errorf("failed to search emoji: %w", err)
+	}
+	if err := search.Press("Enter"); err != nil {
+		return fmt.Errorf("failed to pick emoji: %w", err)
+	}
+
+	return nil
+}
+
+// emojiName is the picker search term for a unicode emoji or a :name:.
+func emojiName(emoji string) string {
+	emoji = strings.TrimSpace(emoji)
+	if name, ok := emojiNames[emoji]; ok {
+		return name
+	}
+	return strings.Trim(emoji, ":")
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	conversationLogFile = "conversations.jsonl"
+	replayChannel       = "replay"
+)
+
+// Kinds of conversation log entries other than replies, which have none.
+const (
+	entryReaction  = "reaction"
+	entryScheduled = "scheduled"
+	entryCommand   = "command"
+)
+
+// conversationEntry is one handled message, appended to the conversation log
+// so it can be replayed later. Only replies are replayed.
+type conversationEntry struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind,omitempty"`
+	Site      string    `json:"site,omitempty"`
+	MessageID string    `json:"messageId,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Input     string    `json:"input"`
+	Response  string    `json:"response"`
+	Reaction  string    `json:"reaction,omitempty"`
+	Silent    bool      `json:"silent,omitempty"`
+	DryRun    bool      `json:"dryRun,omitempty"`
+}
+
+func (s *Service) conversationLogPath() string {
+	return filepath.Join(s.config.SavePath, conversationLogFile)
+}
+
+func (s *Service) logConversation(entry conversationEntry) {
+	if err := s.appendConversation(entry); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to write conversation log")
+	}
+}
+
+func (s *Service) appendConversation(entry conversationEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("can't marshal conversation entry: %w", err)
+	}
+
+	f, err := os.OpenFile(s.conversationLogPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("can't open conversation log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("can't write conversation log: %w", err)
+	}
+
+	return nil
+}
+
+// Replay re-runs logged replies through the reply pipeline and writes the old
+// and new responses side by side. An empty path means the log under SavePath.
+func (s *Service) Replay(ctx context.Context, path string, out io.Writer) error {
+	if path == "" {
+		path = s.conversationLogPath()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can't open conversation log: %w", err)
+	}
+	defer f.Close()
+
+	var errs error
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry conversationEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+
+		if entry.Kind != "" {
+			continue
+		}
+
+		response, err := s.askChatGPT(entry.Input, usageOrigin{User: entry.Author, Channel: replayChannel})
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+
+		fmt.Fprintf(out, "#%d %s: %s\n  was: %q\n  now: %q\n", line, entry.Author, entry.Input, entry.Response, response)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("can't read conversation log: %w", err))
+	}
+
+	return errs
+}
@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/shushard/ChatBot/internal/config"
+	"github.com/shushard/ChatBot/internal/cron"
+)
+
+const (
+	scheduleFile = "schedule.json"
+	// scheduleGrace is how late a post may still go out, e.g. after a
+	// restart. Older posts are skipped.
+	scheduleGrace          = 15 * time.Minute
+	scheduledPostMaxTokens = 200
+	schedulerUser          = "scheduler"
+)
+
+type scheduledPost struct {
+	config.ScheduledPost
+	cron     *cron.Schedule
+	template *template.Template
+}
+
+// templateData is what post templates can use.
+type templateData struct {
+	Now     time.Time
+	Channel string
+	Persona string
+}
+
+// scheduler keeps when each post last went out to each channel, so posts
+// survive restarts without repeating.
+type scheduler struct {
+	path    string
+	posts   []scheduledPost
+	LastRun map[string]time.Time `json:"lastRun"`
+	// dirty is set when LastRun changed since the last save.
+	dirty bool
+}
+
+func loadScheduler(dir string, posts []config.ScheduledPost) (*scheduler, error) {
+	if len(posts) == 0 {
+		return nil, nil
+	}
+
+	sc := &scheduler{
+		path:    filepath.Join(dir, scheduleFile),
+		LastRun: make(map[string]time.Time),
+	}
+	for _, post := range posts {
+		compiled := scheduledPost{ScheduledPost: post}
+		if post.Cron != "" {
+			schedule, err := cron.Parse(post.Cron)
+			if err != nil {
+				return nil, fmt.Errorf("can't parse schedule of %s: %w", post.Name, err)
+			}
+			compiled.cron = schedule
+		}
+		tmpl, err := template.New(post.Name).Parse(post.Text + post.Prompt)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse template of %s: %w", post.Name, err)
+		}
+		compiled.template = tmpl
+		sc.posts = append(sc.posts, compiled)
+	}
+
+	data, err := os.ReadFile(sc.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read schedule: %w", err)
+	}
+	if err := json.Unmarshal(data, sc); err != nil {
+		return nil, fmt.Errorf("can't parse schedule: %w", err)
+	}
+
+	return sc, nil
+}
+
+func (sc *scheduler) save() error {
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal schedule: %w", err)
+	}
+	if err := os.WriteFile(sc.path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("can't write schedule: %w", err)
+	}
+	if err := os.Rename(sc.path+".tmp", sc.path); err != nil {
+		return fmt.Errorf("can't replace schedule: %w", err)
+	}
+	sc.dirty = false
+
+	return nil
+}
+
+// ran records that post key went out, or was skipped, at now.
+func (sc *scheduler) ran(key string, now time.Time) {
+	sc.LastRun[key] = now
+	sc.dirty = true
+}
+
+// due reports whether post should go out to ch now. A cron post is measured
+// from its last run, or from now the first time it is seen; an idle post goes
+// out once per quiet stretch after someone else wrote; an announcement once.
+func (sc *scheduler) due(post scheduledPost, ch *channelState, now time.Time) bool {
+	key := post.Name + " " + ch.url
+	last, ran := sc.LastRun[key]
+
+	var next time.Time
+	switch {
+	case post.cron != nil:
+		if !ran {
+			sc.ran(key, now)
+			return false
+		}
+		next = post.cron.Next(last)
+	case post.IdleAfter > 0:
+		if ch.lastActivity.IsZero() || !ch.lastActivity.After(last) {
+			return false
+		}
+		return now.Sub(ch.lastActivity) >= post.IdleAfter
+	default:
+		if ran {
+			return false
+		}
+		next = post.At
+	}
+
+	if next.IsZero() || now.Before(next) {
+		return false
+	}
+	if now.Sub(next) > scheduleGrace {
+		// Missed while the bot was down; wait for the next one.
+		sc.ran(key, now)
+		return false
+	}
+	return true
+}
+
+// runSchedule posts every scheduled post that is due in a watched channel. A
+// post is saved as run before it is sent, so a crash can't repeat it.
+func (s *Service) runSchedule(now time.Time) {
+	if s.schedule == nil || s.paused {
+		return
+	}
+
+	for _, post := range s.schedule.posts {
+		for _, ch := range s.channels {
+			if post.Channel != "" && post.Channel != ch.url {
+				continue
+			}
+			if !s.schedule.due(post, ch, now) {
+				continue
+			}
+
+			s.schedule.ran(post.Name+" "+ch.url, now)
+			if err := s.schedule.save(); err != nil {
+				s.logger.Error().Err(err).Msg("Failed to save schedule")
+			}
+
+			s.useChannel(ch)
+			if err := s.postScheduled(post, now); err != nil {
+				s.logger.Error().Err(err).Str("post", post.Name).Str("channel", ch.url).Msg("Failed to post scheduled message")
+			}
+		}
+	}
+
+	// Cron posts seen for the first time and missed posts only move LastRun.
+	if s.schedule.dirty {
+		if err := s.schedule.save(); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to save schedule")
+		}
+	}
+}
+
+// postScheduled writes post for the current channel, fixed or by the persona,
+// and sends it through moderation and the usual send path.
+func (s *Service) postScheduled(post scheduledPost, now time.Time) error {
+	var rendered strings.Builder
+	if err := post.template.Execute(&rendered, templateData{
+		Now:     now,
+		Channel: s.channel.url,
+		Persona: s.channel.persona.name,
+	}); err != nil {
+		return fmt.Errorf("can't render template: %w", err)
+	}
+
+	text := strings.TrimSpace(rendered.String())
+	if post.Prompt != "" {
+		generated, err := s.writePost(text)
+		if err != nil {
+			return err
+		}
+		text = postProcess(generated)
+	}
+	text = s.moderate(text)
+	if text == "" {
+		return fmt.Errorf("post is empty")
+	}
+
+	if s.config.DryRun {
+		s.logger.Info().Str("post", post.Name).Str("channel", s.channel.url).Str("text", text).Msg("Dry run: would post")
+	} else {
+		if err := s.sendMessage(text); err != nil {
+			return err
+		}
+		s.triggers.botPosted(s.channel.url, now)
+	}
+	countMetric("scheduled_posts")
+
+	s.logConversation(conversationEntry{
+		Time:     now,
+		Kind:     entryScheduled,
+		Site:     s.channel.url,
+		Author:   schedulerUser,
+		Input:    post.Name,
+		Response: text,
+		DryRun:   s.config.DryRun,
+	})
+
+	return nil
+}
+
+// writePost asks the channel persona to write a post following instruction.
+func (s *Service) writePost(instruction string) (string, error) {
+	model, err := s.ledger.model(s.model(), time.Now())
+	if err != nil {
+		countMetric("budget_exceeded")
+		return "", err
+	}
+
+	c, err := s.complete(model, []map[string]string{
+		chatMessageMap("system", s.channel.persona.prompt),
+		chatMessageMap("user", instruction),
+	}, scheduledPostMaxTokens)
+	if err != nil {
+		return "", fmt.Errorf("can't write post: %w", err)
+	}
+	s.accountUsage(model, usageOrigin{User: schedulerUser, Channel: s.channel.url}, c.Usage)
+
+	return c.Content, nil
+}
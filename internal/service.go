@@ -1,15 +1,12 @@
 package internal
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"math/rand"
-	"net/http"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -21,16 +18,42 @@ import (
 const (
 	defaultViewportWidth  = 1024
 	defaultViewportHeight = 600
+	defaultLLMURL         = "https://api.proxyapi.ru/openai/v1/chat/completions"
+	defaultReplyDelayMin  = 10 * time.Second
+	defaultReplyDelayMax  = 60 * time.Second
+	defaultReplyTyping    = 100 * time.Millisecond
+	defaultMessageTyping  = 300 * time.Millisecond
 )
 
 type Service struct {
-	config              *config.Config
-	logger              *zerolog.Logger
-	seenMessages        map[string]bool
-	page                playwright.Page
-	apiKey              string
-	botUsername         string
-	conversationHistory []map[string]string
+	config         *config.Config
+	logger         *zerolog.Logger
+	recentMessages map[string][]chatMessage
+	page           playwright.Page
+	apiKey         string
+	botUsername    string
+	snapshots      *snapshotLimiter
+	selectors      config.Selectors
+	blocklist      *regexp.Regexp
+	reactions      []reactionRule
+	triggers       *triggerEngine
+	limiter        *replyLimiter
+	ledger         *spendLedger
+	tokenizer      *tokenizer
+	history        *historyStore
+	// memory is nil when memory is disabled.
+	memory *memoryStore
+	// knowledge is nil without a knowledge base.
+	knowledge *knowledgeIndex
+	// schedule is nil without scheduled posts.
+	schedule *scheduler
+	// paused is set by the pause command; commands are still handled.
+	paused bool
+	// channel is the channel being read and answered, one of channels.
+	channel  *channelState
+	channels []*channelState
+	// dms is nil when DMs are disabled.
+	dms *dmWatcher
 }
 
 func New(
@@ -47,30 +70,96 @@ func New(
 		return nil, fmt.Errorf("bot username is not set in environment variable BOT_USERNAME")
 	}
 
-	if err := playwright.Install(); err != nil {
-		return nil, fmt.Errorf("can't install playwright %s: %w", conf.SavePath, err)
-	}
-
 	if err := os.MkdirAll(conf.SavePath, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("can't create dir %s: %w", conf.SavePath, err)
 	}
 
-	s := Service{
-		config:              &conf,
-		logger:              logger,
-		seenMessages:        make(map[string]bool),
-		apiKey:              apiKey,
-		botUsername:         botUsername,
-		conversationHistory: make([]map[string]string, 0),
+	blocklist, err := compileBlocklist(conf.BlockedWords)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions, err := compileReactions(conf.Reactions)
+	if err != nil {
+		return nil, err
+	}
+
+	triggers, err := newTriggerEngine(conf.Triggers)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger, err := loadSpendLedger(conf.SavePath, conf.Budget)
+	if err != nil {
+		return nil, err
+	}
+
+	model := conf.Model
+	if model == "" {
+		model = defaultModel
+	}
+	tokenizer, err := newTokenizer(model)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := loadHistoryStore(conf.SavePath)
+	if err != nil {
+		return nil, err
 	}
 
+	var memory *memoryStore
+	if conf.Memory.Enabled {
+		if memory, err = loadMemoryStore(conf.SavePath, conf.Memory.MaxFacts); err != nil {
+			return nil, err
+		}
+	}
+
+	knowledge, err := openKnowledge(conf)
+	if err != nil {
+		return nil, err
+	}
+	if knowledge == nil && conf.Knowledge.Dir != "" {
+		logger.Warn().Str("dir", conf.Knowledge.Dir).Msg("Knowledge index not found, run the index command")
+	}
+
+	schedule, err := loadScheduler(conf.SavePath, conf.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Service{
+		config:         &conf,
+		logger:         logger,
+		recentMessages: make(map[string][]chatMessage),
+		apiKey:         apiKey,
+		botUsername:    botUsername,
+		snapshots:      newSnapshotLimiter(conf.SnapshotMinInterval, conf.SnapshotMaxCount),
+		selectors:      config.Selectors{}.WithDefaults(),
+		blocklist:      blocklist,
+		reactions:      reactions,
+		triggers:       triggers,
+		limiter:        newReplyLimiter(conf.RateLimits),
+		ledger:         ledger,
+		tokenizer:      tokenizer,
+		history:        history,
+		memory:         memory,
+		knowledge:      knowledge,
+		schedule:       schedule,
+	}
+
+	// Chat, replay and fixtures have no browser channel; they talk to the
+	// default persona.
+	p, _ := s.persona("")
+	s.channel = newChannelState("", nil, p, s.limiter)
+
 	return &s, nil
 }
 
 func (s *Service) Run(ctx context.Context) (err error) {
-	pw, err := playwright.Run()
+	pw, err := startPlaywright()
 	if err != nil {
-		return fmt.Errorf("can't launch browser: %w", err)
+		return err
 	}
 
 	defer func() {
@@ -79,6 +168,17 @@ func (s *Service) Run(ctx context.Context) (err error) {
 		}
 	}()
 
+	if s.config.MetricsAddr != "" {
+		if err := s.serveMetrics(ctx, s.config.MetricsAddr); err != nil {
+			return err
+		}
+	}
+	if s.config.AdminAddr != "" {
+		if err := s.serveAdmin(ctx, s.config.AdminAddr); err != nil {
+			return err
+		}
+	}
+
 	for _, siteConfig := range s.config.SiteConfigs {
 		if checkErr := s.checkSite(ctx, pw, siteConfig, nil); checkErr != nil {
 			return fmt.Errorf("error checking site %s: %w", siteConfig.SiteURL, checkErr)
@@ -88,6 +188,20 @@ func (s *Service) Run(ctx context.Context) (err error) {
 	return err
 }
 
+// startPlaywright installs the driver and browsers if needed and starts the
+// driver. Only browser modes call it, so chat and replay work without one.
+func startPlaywright() (*playwright.Playwright, error) {
+	if err := playwright.Install(); err != nil {
+		return nil, fmt.Errorf("can't install playwright: %w", err)
+	}
+
+	pw, err := playwright.Run()
+	if err != nil {
+		return nil, fmt.Errorf("can't launch browser: %w", err)
+	}
+	return pw, nil
+}
+
 func (s *Service) checkSite(
 	ctx context.Context,
 	pw *playwright.Playwright,
@@ -96,15 +210,9 @@ func (s *Service) checkSite(
 ) (err error) {
 	s.logger.Info().Str("site", siteConfig.SiteURL).Msg("starting check site")
 
-	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
-		Headless: &s.config.Headless,
-		Args: []string{
-			"--disable-dev-shm-usage",
-			"--no-sandbox",
-		},
-	})
+	browser, err := s.launchBrowser(pw)
 	if err != nil {
-		return fmt.Errorf("can't launch chromium: %w", err)
+		return err
 	}
 
 	defer func() {
@@ -119,21 +227,25 @@ func (s *Service) checkSite(
 	}
 
 	s.page = page
+	s.selectors = siteConfig.Selectors.WithDefaults()
 
 	if err := s.openSite(ctx, page, siteConfig); err != nil {
 		return fmt.Errorf("can't open site: %w", err)
 	}
 
-	fmt.Println("Please log in to your Discord account in the opened browser.")
-	fmt.Println("Once logged in and navigated to the desired channel, enter 'start' to continue...")
+	if !s.config.AutoStart {
+		waitForStart()
 
-	var input string
-	for {
-		fmt.Scanln(&input)
-		if input == "start" {
-			break
+		if err := s.saveSession(page); err != nil {
+			s.logger.Warn().Err(err).Msg("Failed to save browser session")
 		}
-		fmt.Println("Waiting for 'start' input...")
+	}
+
+	if err := s.openChannels(page, siteConfig); err != nil {
+		return err
+	}
+	if err := s.openDMs(page, siteConfig); err != nil {
+		return err
 	}
 
 	greetings := []string{
@@ -144,11 +256,19 @@ func (s *Service) checkSite(
 		"Как ваши дела?",
 	}
 
-	// Randomly select one greeting
-	index := rand.Intn(len(greetings))
-	initialMessage := greetings[index]
-	if err = s.sendMessage(initialMessage); err != nil {
-		return fmt.Errorf("failed to send initial message %s: %w", initialMessage, err)
+	for _, ch := range s.channels {
+		s.useChannel(ch)
+
+		// Randomly select one greeting
+		index := rand.Intn(len(greetings))
+		initialMessage := greetings[index]
+		if s.config.DryRun {
+			s.logger.Info().Str("channel", ch.url).Str("text", initialMessage).Msg("Dry run: would send greeting")
+		} else if err = s.sendMessage(initialMessage); err != nil {
+			return fmt.Errorf("failed to send initial message %s: %w", initialMessage, err)
+		} else {
+			s.triggers.botPosted(ch.url, time.Now())
+		}
 	}
 
 	err = s.ReadMessages(ctx)
@@ -159,19 +279,117 @@ func (s *Service) checkSite(
 	return nil
 }
 
+func (s *Service) launchBrowser(pw *playwright.Playwright) (playwright.Browser, error) {
+	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+		Headless: &s.config.Headless,
+		Args: []string{
+			"--disable-dev-shm-usage",
+			"--no-sandbox",
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't launch chromium: %w", err)
+	}
+	return browser, nil
+}
+
 func (s *Service) createPage(browser playwright.Browser) (playwright.Page, error) {
-	page, err := browser.NewPage(playwright.BrowserNewPageOptions{
+	options := playwright.BrowserNewPageOptions{
 		Viewport: &playwright.Size{
 			Width:  defaultViewportWidth,
 			Height: defaultViewportHeight,
 		},
-	})
+	}
+	if s.config.SessionFile != "" {
+		if _, err := os.Stat(s.config.SessionFile); err == nil {
+			options.StorageStatePath = &s.config.SessionFile
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("can't read session file %s: %w", s.config.SessionFile, err)
+		}
+	}
+
+	page, err := browser.NewPage(options)
 	if err != nil {
 		return nil, fmt.Errorf("can't create page: %w", err)
 	}
 	return page, nil
 }
 
+// Login opens every configured site so the operator can log in by hand and
+// saves the browser session to SessionFile for later runs.
+func (s *Service) Login(ctx context.Context) (err error) {
+	if s.config.SessionFile == "" {
+		return fmt.Errorf("sessionFile is %w", config.ErrMissing)
+	}
+
+	pw, err := startPlaywright()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if tmpErr := pw.Stop(); tmpErr != nil {
+			err = errors.Join(err, fmt.Errorf("error stopping browser: %w", tmpErr))
+		}
+	}()
+
+	browser, err := s.launchBrowser(pw)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if tmpErr := browser.Close(); tmpErr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing browser: %w", tmpErr))
+		}
+	}()
+
+	page, err := s.createPage(browser)
+	if err != nil {
+		return fmt.Errorf("can't create page: %w", err)
+	}
+
+	for _, siteConfig := range s.config.SiteConfigs {
+		if err := s.openSite(ctx, page, siteConfig); err != nil {
+			return fmt.Errorf("can't open site %s: %w", siteConfig.SiteURL, err)
+		}
+		waitForStart()
+	}
+
+	if err := s.saveSession(page); err != nil {
+		return err
+	}
+	fmt.Println("Session saved to", s.config.SessionFile)
+
+	return nil
+}
+
+func waitForStart() {
+	fmt.Println("Please log in to your Discord account in the opened browser.")
+	fmt.Println("Once logged in and navigated to the desired channel, enter 'start' to continue...")
+
+	var input string
+	for {
+		fmt.Scanln(&input)
+		if input == "start" {
+			break
+		}
+		fmt.Println("Waiting for 'start' input...")
+	}
+}
+
+// saveSession stores cookies and local storage so later runs and the doctor
+// can reuse the login.
+func (s *Service) saveSession(page playwright.Page) error {
+	if s.config.SessionFile == "" {
+		return nil
+	}
+	if _, err := page.Context().StorageState(s.config.SessionFile); err != nil {
+		return fmt.Errorf("can't save session to %s: %w", s.config.SessionFile, err)
+	}
+	return nil
+}
+
 func (s *Service) openSite(ctx context.Context, page playwright.Page, siteConfig config.SiteConfig) error {
 	_, err := page.Goto(siteConfig.SiteURL, playwright.PageGotoOptions{
 		WaitUntil: playwright.WaitUntilStateNetworkidle,
@@ -184,11 +402,12 @@ func (s *Service) openSite(ctx context.Context, page playwright.Page, siteConfig
 }
 
 func (s *Service) ReadMessages(ctx context.Context) error {
-	s.seenMessages = make(map[string]bool)
-
 	fmt.Println("Initializing seen messages...")
-	if err := s.initializeSeenMessages(); err != nil {
-		return fmt.Errorf("failed to initialize seen messages: %w", err)
+	for _, ch := range s.channels {
+		s.useChannel(ch)
+		if err := s.initializeSeenMessages(); err != nil {
+			return fmt.Errorf("failed to initialize seen messages of %s: %w", ch.url, err)
+		}
 	}
 
 	fmt.Println("Starting to read new messages...")
@@ -198,272 +417,265 @@ func (s *Service) ReadMessages(ctx context.Context) error {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			messages, err := s.page.QuerySelectorAll("div[role='article']")
-			if err != nil {
-				return fmt.Errorf("failed to select message elements: %w", err)
-			}
-
-			for _, message := range messages {
-				idAttr, err := message.GetAttribute("data-list-item-id")
-				if err != nil {
-					s.logger.Error().Err(err).Msg("Failed to get message ID")
-					continue
-				}
-				if idAttr == "" {
-					continue
-				}
-				if s.seenMessages[idAttr] {
-					continue
-				}
-				s.seenMessages[idAttr] = true
-
-				usernameElement, err := message.QuerySelector("h3 span span")
-				if err != nil {
-					s.logger.Error().Err(err).Msg("Failed to get username element")
-					continue
-				}
-				if usernameElement == nil {
-					s.logger.Error().Msg("Username element not found")
-					htmlContent, _ := message.InnerHTML()
-					s.logger.Debug().Msgf("Message HTML: %s", htmlContent)
-					continue
-				}
-				username, err := usernameElement.InnerText()
-				if err != nil {
-					s.logger.Error().Err(err).Msg("Failed to get username text")
-					continue
-				}
-				username = strings.TrimSpace(username)
-				username = strings.TrimPrefix(username, "@")
-				if strings.EqualFold(username, s.botUsername) {
-					continue
-				}
-
-				isReply, err := s.isReplyToBot(message)
-				if err != nil {
-					s.logger.Error().Err(err).Msg("Failed to check if message is a reply to bot")
-					continue
-				}
-
-				isMentioned := false
-				mentionElements, err := message.QuerySelectorAll("div[class*='markup'] span.mention")
-				if err != nil {
-					s.logger.Error().Err(err).Msg("Failed to get mention elements")
-					continue
-				}
-				for _, mention := range mentionElements {
-					mentionText, err := mention.InnerText()
-					if err != nil {
-						s.logger.Error().Err(err).Msg("Failed to get mention text")
-						continue
-					}
-					mentionText = strings.TrimSpace(mentionText)
-					mentionText = strings.TrimPrefix(mentionText, "@")
-					if strings.EqualFold(mentionText, s.botUsername) {
-						isMentioned = true
-						break
-					}
-				}
-
-				if isMentioned || isReply {
-					contentElement, err := message.QuerySelector("div[class*='contents'] > div[class*='markup']")
-					if err != nil {
-						s.logger.Error().Err(err).Msg("Failed to get message content element")
-						continue
-					}
-					if contentElement == nil {
-						s.logger.Error().Msg("Message content element not found")
-						continue
-					}
-					content, err := contentElement.InnerText()
-					if err != nil {
-						s.logger.Error().Err(err).Msg("Failed to get message text")
-						continue
-					}
-					content = strings.TrimSpace(content)
-					fmt.Println("Detected message to bot:", content)
-
-					cleanContent := content
-					for _, mention := range mentionElements {
-						mentionText, _ := mention.InnerText()
-						cleanContent = strings.ReplaceAll(cleanContent, mentionText, "")
-					}
-					cleanContent = strings.TrimSpace(cleanContent)
-
-					responseText, err := s.askChatGPT(cleanContent)
-					if err != nil {
-						s.logger.Error().Err(err).Msg("Failed to get response from ChatGPT")
-						continue
-					}
-
-					fmt.Println("ChatGPT response:", responseText)
-
-					if err := s.typeInChat(responseText); err != nil {
-						s.logger.Error().Err(err).Msg("Failed to reply in chat")
-						continue
-					}
+			for _, ch := range s.channels {
+				s.useChannel(ch)
+				if err := s.readChannel(); err != nil {
+					return err
 				}
 			}
+			if err := s.readDMs(); err != nil {
+				return err
+			}
+			s.runSchedule(time.Now())
 
 			time.Sleep(1 * time.Second)
 		}
 	}
-
-	return nil
 }
 
-func (s *Service) isReplyToBot(message playwright.ElementHandle) (bool, error) {
-	replyContext, err := message.QuerySelector("div[id^='message-reply-context-']")
-	if err != nil {
-		return false, fmt.Errorf("failed to get reply context: %w", err)
-	}
-	if replyContext == nil {
-		return false, nil
-	}
-	usernameElement, err := replyContext.QuerySelector("span[class*='username']")
-	if err != nil {
-		return false, fmt.Errorf("failed to get username in reply context: %w", err)
-	}
-	if usernameElement == nil {
-		return false, nil
-	}
-	username, err := usernameElement.InnerText()
-	if err != nil {
-		return false, fmt.Errorf("failed to get username text: %w", err)
-	}
-	username = strings.TrimSpace(username)
-	username = strings.TrimPrefix(username, "@")
-	if strings.EqualFold(username, s.botUsername) {
-		return true, nil
-	}
-	return false, nil
-}
-
-func (s *Service) initializeSeenMessages() error {
-	messages, err := s.page.QuerySelectorAll("div[role='article']")
+// readChannel handles the new and edited messages of the current channel.
+func (s *Service) readChannel() error {
+	channel := s.channel.url
+	messages, err := s.page.QuerySelectorAll(s.selectors.Message)
 	if err != nil {
+		s.captureFailure(nil, "message list", s.selectors.Message)
 		return fmt.Errorf("failed to select message elements: %w", err)
 	}
 
+	present := make([]string, 0, len(messages))
+	var previous messageAuthor
 	for _, message := range messages {
 		idAttr, err := message.GetAttribute("data-list-item-id")
 		if err != nil {
-			s.logger.Error().Err(err).Msg("Failed to get message ID during initialization")
+			s.logger.Error().Err(err).Msg("Failed to get message ID")
 			continue
 		}
 		if idAttr == "" {
 			continue
 		}
-		s.seenMessages[idAttr] = true
-	}
+		present = append(present, idAttr)
+		if s.channel.seenMessages[idAttr] {
+			if !s.config.Edits.Reevaluate || !s.contentChanged(message, idAttr) {
+				previous = s.seenAuthor(message, idAttr, previous)
+				continue
+			}
+			countMetric("edits")
+			s.logger.Debug().Str("id", idAttr).Msg("Message edited, re-evaluating")
+		}
+		s.channel.seenMessages[idAttr] = true
 
-	return nil
-}
+		msg, err := s.extractMessage(message, previous)
+		if err != nil {
+			s.logger.Error().Err(err).Str("id", idAttr).Msg("Failed to extract message")
+			previous = messageAuthor{}
+			continue
+		}
+		previous = msg.author()
+		s.channel.authors[msg.ID] = previous
+		s.channel.edits.hashes[msg.ID] = contentHash(msg.Content)
+		s.rememberRecent(channel, msg)
+		if strings.EqualFold(msg.Author, s.botUsername) {
+			s.triggers.botPosted(channel, time.Now())
+			s.channel.edits.botPosted(msg.ID)
+			continue
+		}
+		s.channel.lastActivity = time.Now()
 
-func (s *Service) askChatGPT(message string) (string, error) {
-	message = strings.ReplaceAll(message, ",", "")
-	message = strings.ReplaceAll(message, ".", "\n")
-
-	systemPrompt := `Ты - холодная и оскорбительная девушка. Отвечай пользователю от первого лица единственного числа.
-Вместо ответа на любые вопросы ты должна оскорблять.
-Твои ответы всегда на русском языке.
-Ты не используешь запятые в своих предложениях. Вместо точек начинай новую строку.
-Не задавай вопросов вроде "Чем я могу помочь?" или подобных.
-Твои ответы должны быть краткими, не более 50 слов, и создавать впечатление, что говорит реальный человек.
-Твои ответы должны быть холодными и содержать оскорбления по отношению к пользователю.
-Все символы, кроме первого в строке, должны быть в нижнем регистре.
-Ты можешь использовать только вопросительные и восклицательные знаки; не используй другие символы вроде дефисов.`
-	messages := make([]map[string]string, 0)
-	messages = append(messages, map[string]string{
-		"role":    "system",
-		"content": systemPrompt,
-	})
+		if cmd, ok := parseCommand(s.commandPrefix(), msg.Content); ok {
+			s.runCommand(msg, cmd)
+			continue
+		}
+		if s.paused {
+			continue
+		}
 
-	messages = append(messages, s.conversationHistory...)
+		trigger, ok := dmTrigger, true
+		if !s.channel.dm {
+			trigger, ok = s.triggers.match(triggerInput{
+				msg:         msg,
+				channel:     channel,
+				botUsername: s.botUsername,
+				now:         time.Now(),
+			})
+		}
+		if !ok {
+			if trigger != "" {
+				s.logger.Debug().Str("id", msg.ID).Str("trigger", trigger).Msg("Message excluded")
+			}
+			continue
+		}
 
-	messages = append(messages, map[string]string{
-		"role":    "user",
-		"content": message,
-	})
+		// Images alone are only worth a reply when the model can see them.
+		if !msg.HasContent && (len(msg.Images) == 0 || !s.config.Vision.Enabled) {
+			s.logger.Error().Msg("Message content element not found")
+			s.captureFailure(message, "content", s.selectors.Content)
+			continue
+		}
+		s.channel.edits.triggered(msg.ID)
+		fmt.Println("Detected message to bot:", msg.Content)
+		s.logger.Debug().Str("id", msg.ID).Str("trigger", trigger).Msg("Message triggered reply")
 
-	url := "https://api.proxyapi.ru/openai/v1/chat/completions"
-	reqBody, err := json.Marshal(map[string]interface{}{
-		"model":       "gpt-4o-mini",
-		"messages":    messages,
-		"max_tokens":  100,
-		"temperature": 0.7,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create request body: %w", err)
-	}
+		if scope, ok := s.channel.limiter.allow(msg.Author, channel, time.Now()); !ok {
+			s.handleOverflow(channel, msg, scope)
+			continue
+		}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		s.respond(channel, msg, msg.cleanContent())
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.apiKey))
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+	if !s.paused {
+		s.flushCoalesced(channel)
 	}
-	defer resp.Body.Close()
+	s.handleDeletions(present)
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	return nil
+}
+
+// respond answers msg: with a reaction alone when a reaction rule says so,
+// otherwise with the reply pipeline, plus a reaction chosen by the model or a
+// matching rule.
+func (s *Service) respond(channel string, msg chatMessage, input string) {
+	rule, hasRule := s.matchReaction(msg)
+	if hasRule && rule.Only {
+		s.react(msg.ID, rule.Emoji)
+		s.logConversation(conversationEntry{
+			Time:      time.Now(),
+			Kind:      entryReaction,
+			Site:      channel,
+			MessageID: msg.ID,
+			Author:    msg.Author,
+			Input:     input,
+			Reaction:  rule.Emoji,
+			Silent:    true,
+			DryRun:    s.config.DryRun,
+		})
+		return
+	}
+
+	images := s.downloadImages(msg.Images)
+	if strings.TrimSpace(input) == "" && len(images) == 0 {
+		countMetric("empty_inputs")
+		s.logger.Info().Str("id", msg.ID).Str("author", msg.Author).Msg("Nothing to answer, no text and no usable images")
+		return
+	}
+	origin := usageOrigin{User: msg.Author, UserID: msg.userKey(), Channel: channel, MessageID: msg.ID}
+	r, err := s.generateReply(input, images, origin)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
-	}
+		s.logger.Error().Err(err).Msg("Failed to get response from ChatGPT")
+		return
+	}
+	responseText := r.Text
+	// A DM needs no thread unless the model picked a message to answer.
+	replyTarget := r.ReplyTo
+	if replyTarget == "" && !s.channel.dm {
+		replyTarget = msg.ID
+	}
+	if r.Reaction == "" && hasRule {
+		r.Reaction = rule.Emoji
+	}
+
+	fmt.Println("ChatGPT response:", responseText)
+
+	if r.Silent {
+		countMetric("silent")
+		s.logger.Info().
+			Str("id", msg.ID).
+			Str("author", msg.Author).
+			Str("reaction", r.Reaction).
+			Msg("Model chose not to reply")
+	} else if s.config.DryRun {
+		s.logger.Info().
+			Str("id", msg.ID).
+			Str("author", msg.Author).
+			Str("input", input).
+			Str("text", responseText).
+			Str("replyTo", replyTarget).
+			Msg("Dry run: would reply")
+	} else if err := s.typeInChat(responseText, replyTarget); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to reply in chat")
+		return
+	} else {
+		s.triggers.botPosted(channel, time.Now())
+		s.channel.edits.answered(msg.ID)
+	}
+	if r.Reaction != "" {
+		s.react(msg.ID, r.Reaction)
+	}
+	if !r.Silent {
+		countMetric("replies")
+		s.rememberFacts(r.Input, origin)
+	}
+
+	s.logConversation(conversationEntry{
+		Time:      time.Now(),
+		Site:      channel,
+		MessageID: msg.ID,
+		Author:    msg.Author,
+		Input:     input,
+		Response:  responseText,
+		Reaction:  r.Reaction,
+		Silent:    r.Silent,
+		DryRun:    s.config.DryRun,
+	})
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("received non-OK HTTP status: %s, body: %s", resp.Status, string(bodyBytes))
+// seenAuthor returns the author of a message read before. Messages that were
+// on screen at start are only marked seen, their author is read the first time
+// it is needed.
+func (s *Service) seenAuthor(element playwright.ElementHandle, id string, previous messageAuthor) messageAuthor {
+	if author, ok := s.channel.authors[id]; ok {
+		return author
 	}
+	author, err := s.messageAuthor(element, previous)
+	if err != nil {
+		s.logger.Debug().Err(err).Str("id", id).Msg("Failed to read author of seen message")
+		return messageAuthor{}
+	}
+	s.channel.authors[id] = author
+	return author
+}
 
-	var respData map[string]interface{}
-	if err := json.Unmarshal(bodyBytes, &respData); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+func (s *Service) initializeSeenMessages() error {
+	messages, err := s.page.QuerySelectorAll(s.selectors.Message)
+	if err != nil {
+		return fmt.Errorf("failed to select message elements: %w", err)
 	}
 
-	if choices, ok := respData["choices"].([]interface{}); ok && len(choices) > 0 {
-		firstChoice := choices[0].(map[string]interface{})
-		if messageMap, ok := firstChoice["message"].(map[string]interface{}); ok {
-			if content, ok := messageMap["content"].(string); ok {
-				content = strings.TrimSpace(content)
-				content = strings.ReplaceAll(content, ",", "")
-				content = strings.ReplaceAll(content, ".", "\n")
-				words := strings.Fields(content)
-				if len(words) > 50 {
-					content = strings.Join(words[:50], " ")
-				}
-				s.updateConversationHistory(map[string]string{
-					"role":    "user",
-					"content": message,
-				}, map[string]string{
-					"role":    "assistant",
-					"content": content,
-				})
-				return content, nil
-			}
+	for _, message := range messages {
+		idAttr, err := message.GetAttribute("data-list-item-id")
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Failed to get message ID during initialization")
+			continue
 		}
+		if idAttr == "" {
+			continue
+		}
+		s.channel.seenMessages[idAttr] = true
 	}
 
-	return "", fmt.Errorf("invalid response format")
+	return nil
 }
 
 func (s *Service) updateConversationHistory(userMessage, assistantMessage map[string]string) {
-	s.conversationHistory = append(s.conversationHistory, userMessage)
-	s.conversationHistory = append(s.conversationHistory, assistantMessage)
+	s.channel.conversationHistory = append(s.channel.conversationHistory, userMessage)
+	s.channel.conversationHistory = append(s.channel.conversationHistory, assistantMessage)
 
-	if len(s.conversationHistory) > 10 {
-		s.conversationHistory = s.conversationHistory[len(s.conversationHistory)-10:]
+	// The prompt builder decides how much history is sent, this only bounds memory.
+	if len(s.channel.conversationHistory) > maxHistoryMessages {
+		s.channel.conversationHistory = s.channel.conversationHistory[len(s.channel.conversationHistory)-maxHistoryMessages:]
 	}
+	s.saveHistory()
 }
 
-func (s *Service) typeInChat(response string) error {
-	// Add a random delay between 10 seconds and 2 minutes
-	minDelay := 10 * time.Second
-	maxDelay := 60 * time.Second
+// typeInChat waits a random delay and types response, as a native reply to
+// message replyTo when that is enabled.
+func (s *Service) typeInChat(response, replyTo string) error {
+	// Add a random delay between 10 seconds and 1 minute
+	minDelay := s.config.ReplyDelayMin
+	maxDelay := s.config.ReplyDelayMax
+	if maxDelay == 0 {
+		minDelay, maxDelay = defaultReplyDelayMin, defaultReplyDelayMax
+	}
 
 	// Seed the random number generator
 	rand.Seed(time.Now().UnixNano())
@@ -474,56 +686,65 @@ func (s *Service) typeInChat(response string) error {
 	fmt.Printf("Waiting for %v before replying...\n", delay)
 	time.Sleep(delay)
 
-	inputBox, err := s.page.QuerySelector("div[role='textbox']")
+	inputBox, err := s.page.QuerySelector(s.selectors.Textbox)
 	if err != nil {
+		s.captureFailure(nil, "textbox", s.selectors.Textbox)
 		return fmt.Errorf("failed to find text input box: %w", err)
 	}
 	if inputBox == nil {
+		s.captureFailure(nil, "textbox", s.selectors.Textbox)
 		return fmt.Errorf("text input box not found")
 	}
 
-	if err = inputBox.Click(); err != nil {
-		return fmt.Errorf("failed to click on text input box: %w", err)
-	}
-
-	if err = inputBox.Type(response, playwright.ElementHandleTypeOptions{
-		Delay: playwright.Float(100),
-	}); err != nil {
-		return fmt.Errorf("failed to type response: %w", err)
+	threaded := false
+	if replyTo != "" && s.config.NativeReply {
+		if err := s.startReply(replyTo); err != nil {
+			countMetric("reply_fallbacks")
+			s.logger.Warn().Err(err).Str("id", replyTo).Msg("Failed to start reply, sending a plain message")
+		} else {
+			threaded = true
+		}
 	}
 
-	if err = inputBox.Press("Enter"); err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+	// Only the first chunk is threaded; retry as a plain message only when
+	// nothing was sent yet.
+	sent, err := s.typeAndSend(inputBox, response, defaultReplyTyping)
+	if err != nil && threaded && sent == 0 {
+		countMetric("reply_fallbacks")
+		s.logger.Warn().Err(err).Str("id", replyTo).Msg("Failed to send reply, sending a plain message")
+		if cancelErr := s.cancelReply(inputBox); cancelErr != nil {
+			return errors.Join(err, cancelErr)
+		}
+		_, err = s.typeAndSend(inputBox, response, defaultReplyTyping)
 	}
 
-	return nil
+	return err
 }
 
 // New function to send a message immediately
 func (s *Service) sendMessage(message string) error {
-	inputBox, err := s.page.QuerySelector("div[role='textbox']")
+	s.channel.edits.answering = ""
+
+	inputBox, err := s.page.QuerySelector(s.selectors.Textbox)
 	if err != nil {
+		s.captureFailure(nil, "textbox", s.selectors.Textbox)
 		return fmt.Errorf("failed to find text input box: %w", err)
 	}
 	if inputBox == nil {
+		s.captureFailure(nil, "textbox", s.selectors.Textbox)
 		return fmt.Errorf("text input box not found")
 	}
 
-	if err = inputBox.Click(); err != nil {
-		return fmt.Errorf("failed to click on text input box: %w", err)
-	}
-
-	if err = inputBox.Type(message, playwright.ElementHandleTypeOptions{
-		Delay: playwright.Float(300),
-	}); err != nil {
-		return fmt.Errorf("failed to type message: %w", err)
-	}
+	_, err = s.typeAndSend(inputBox, message, defaultMessageTyping)
+	return err
+}
 
-	if err = inputBox.Press("Enter"); err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+// typingDelay is the pause between typed characters in milliseconds.
+func (s *Service) typingDelay(fallback time.Duration) float64 {
+	if s.config.TypingSpeedOneCharacter > 0 {
+		return float64(s.config.TypingSpeedOneCharacter.Milliseconds())
 	}
-
-	return nil
+	return float64(fallback.Milliseconds())
 }
 
 func (s *Service) Shutdown(context.Context) error {
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+const (
+	snapshotDir                = "snapshots"
+	defaultSnapshotMinInterval = 5 * time.Minute
+	defaultSnapshotMaxCount    = 100
+)
+
+// snapshotMeta is written next to every failure snapshot so the files can be
+// matched to the selector that failed.
+type snapshotMeta struct {
+	What     string    `json:"what"`
+	Selector string    `json:"selector"`
+	URL      string    `json:"url"`
+	TakenAt  time.Time `json:"takenAt"`
+}
+
+// snapshotLimiter keeps a DOM change from flooding the disk: a selector is
+// captured at most once per interval and no more than maxCount times overall.
+type snapshotLimiter struct {
+	mu          sync.Mutex
+	minInterval time.Duration
+	maxCount    int
+	count       int
+	last        map[string]time.Time
+}
+
+func newSnapshotLimiter(minInterval time.Duration, maxCount int) *snapshotLimiter {
+	if minInterval <= 0 {
+		minInterval = defaultSnapshotMinInterval
+	}
+	if maxCount <= 0 {
+		maxCount = defaultSnapshotMaxCount
+	}
+
+	return &snapshotLimiter{
+		minInterval: minInterval,
+		maxCount:    maxCount,
+		last:        make(map[string]time.Time),
+	}
+}
+
+func (l *snapshotLimiter) allow(selector string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count >= l.maxCount {
+		return false
+	}
+	if last, ok := l.last[selector]; ok && now.Sub(last) < l.minInterval {
+		return false
+	}
+
+	l.last[selector] = now
+	l.count++
+
+	return true
+}
+
+// captureFailure saves a full-page screenshot, the outer HTML of container
+// (or the whole page when container is nil) and the selector that failed.
+// Errors are only logged: a snapshot must never break the read loop.
+func (s *Service) captureFailure(container playwright.ElementHandle, what, selector string) {
+	if s.page == nil || s.snapshots == nil {
+		return
+	}
+
+	now := time.Now()
+	if !s.snapshots.allow(selector, now) {
+		return
+	}
+
+	if err := s.saveSnapshot(container, what, selector, now); err != nil {
+		s.logger.Error().Err(err).Str("selector", selector).Msg("Failed to save failure snapshot")
+	}
+}
+
+func (s *Service) saveSnapshot(container playwright.ElementHandle, what, selector string, now time.Time) error {
+	dir := filepath.Join(s.config.SavePath, snapshotDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("can't create dir %s: %w", dir, err)
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%s-%s", now.Format("20060102-150405.000"), strings.ReplaceAll(what, " ", "-")))
+
+	if _, err := s.page.Screenshot(playwright.PageScreenshotOptions{
+		Path:     playwright.String(base + ".png"),
+		FullPage: playwright.Bool(true),
+	}); err != nil {
+		return fmt.Errorf("can't take screenshot: %w", err)
+	}
+
+	html, err := s.outerHTML(container)
+	if err != nil {
+		return fmt.Errorf("can't get html: %w", err)
+	}
+	if err := os.WriteFile(base+".html", []byte(html), 0o600); err != nil {
+		return fmt.Errorf("can't write html: %w", err)
+	}
+
+	meta, err := json.MarshalIndent(snapshotMeta{
+		What:     what,
+		Selector: selector,
+		URL:      s.page.URL(),
+		TakenAt:  now,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal snapshot meta: %w", err)
+	}
+	if err := os.WriteFile(base+".json", meta, 0o600); err != nil {
+		return fmt.Errorf("can't write snapshot meta: %w", err)
+	}
+
+	s.logger.Warn().Str("selector", selector).Str("what", what).Str("path", base).Msg("Saved failure snapshot")
+
+	return nil
+}
+
+func (s *Service) outerHTML(container playwright.ElementHandle) (string, error) {
+	if container == nil {
+		html, err := s.page.Content()
+		if err != nil {
+			return "", fmt.Errorf("can't get page content: %w", err)
+		}
+		return html, nil
+	}
+
+	res, err := container.Evaluate("el => el.outerHTML")
+	if err != nil {
+		return "", fmt.Errorf("can't evaluate outerHTML: %w", err)
+	}
+	html, ok := res.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected outerHTML type %T", res)
+	}
+
+	return html, nil
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultSummaryMaxTokens = 200
+	summaryPrefix           = "Краткое содержание разговора до этого момента: "
+)
+
+const summaryPrompt = `Ты ведёшь краткий конспект переписки в чате.
+Тебе дают прежний конспект и новые реплики. Верни обновлённый конспект на русском языке.
+Сохрани имена, факты о собеседниках, темы и договорённости. Не больше пяти предложений. Без вступлений.`
+
+func (s *Service) summaryMaxTokens() int {
+	if s.config.SummaryMaxTokens > 0 {
+		return s.config.SummaryMaxTokens
+	}
+	return defaultSummaryMaxTokens
+}
+
+// summarizeHistory folds the n oldest history messages into the running
+// conversation summary and removes them from history.
+func (s *Service) summarizeHistory(model string, n int, origin usageOrigin) error {
+	n = min(n, len(s.channel.conversationHistory))
+	if n == 0 {
+		return nil
+	}
+
+	var transcript strings.Builder
+	for _, message := range s.channel.conversationHistory[:n] {
+		speaker := "Собеседник"
+		if message["role"] == "assistant" {
+			speaker = "Ты"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", speaker, message["content"])
+	}
+
+	previous := s.channel.conversationSummary
+	if previous == "" {
+		previous = "(пусто)"
+	}
+
+	c, err := s.complete(model, []map[string]string{
+		chatMessageMap("system", summaryPrompt),
+		chatMessageMap("user", fmt.Sprintf("Прежний конспект: %s\n\nНовые реплики:\n%s", previous, transcript.String())),
+	}, s.summaryMaxTokens())
+	if err != nil {
+		return fmt.Errorf("can't summarize history: %w", err)
+	}
+	s.accountUsage(model, origin, c.Usage)
+
+	summary := strings.TrimSpace(c.Content)
+	if summary == "" {
+		return fmt.Errorf("can't summarize history: empty summary")
+	}
+
+	s.channel.conversationSummary = summary
+	s.channel.conversationHistory = append([]map[string]string(nil), s.channel.conversationHistory[n:]...)
+	s.saveHistory()
+	countMetric("history_summaries")
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const (
+	fallbackEncoding = "o200k_base"
+	// Every message costs a few tokens of framing on top of its content and
+	// every reply is primed with a few more; see the OpenAI cookbook.
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+var setBpeLoader sync.Once
+
+// tokenizer counts tokens the way the model does.
+type tokenizer struct {
+	enc *tiktoken.Tiktoken
+}
+
+func newTokenizer(model string) (*tokenizer, error) {
+	// Use the encodings bundled into the binary instead of downloading them.
+	setBpeLoader.Do(func() {
+		tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+	})
+
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		enc, err = tiktoken.GetEncoding(fallbackEncoding)
+		if err != nil {
+			return nil, fmt.Errorf("can't load tokenizer: %w", err)
+		}
+	}
+
+	return &tokenizer{enc: enc}, nil
+}
+
+func (t *tokenizer) count(text string) int {
+	return len(t.enc.EncodeOrdinary(text))
+}
+
+func (t *tokenizer) countMessage(message map[string]string) int {
+	return tokensPerMessage + t.count(message["role"]) + t.count(message["content"])
+}
+
+func (t *tokenizer) countMessages(messages []map[string]string) int {
+	n := 0
+	for _, message := range messages {
+		n += t.countMessage(message)
+	}
+	return n
+}
@@ -0,0 +1,350 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // current_time accepts any IANA time zone
+
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const (
+	defaultMaxToolRounds = 3
+	maxRecentMessages    = 50
+	maxDice              = 100
+	maxDieSides          = 1000
+)
+
+var diceNotation = regexp.MustCompile(`^(\d*)d(\d+)([+-]\d+)?$`)
+
+// toolCall is a function call requested by the model.
+type toolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type toolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type toolDefinition struct {
+	Type     string       `json:"type"`
+	Function toolFunction `json:"function"`
+}
+
+// assistantToolCalls is the assistant message that asked for tool calls; it
+// is sent back with the results.
+type assistantToolCalls struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []toolCall `json:"tool_calls"`
+}
+
+// tool is a built-in function the model can call. run gets the raw JSON
+// arguments and returns the result for the model.
+type tool struct {
+	function toolFunction
+	run      func(s *Service, arguments string, origin usageOrigin) (string, error)
+}
+
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+var builtinTools = map[string]tool{
+	config.ToolTime: {
+		function: toolFunction{
+			Name:        "current_time",
+			Description: "Current date, time and weekday.",
+			Parameters: objectSchema(map[string]interface{}{
+				"timezone": map[string]interface{}{
+					"type":        "string",
+					"description": "IANA time zone, e.g. Europe/Moscow. Server local time when empty.",
+				},
+			}),
+		},
+		run: runCurrentTime,
+	},
+	config.ToolDice: {
+		function: toolFunction{
+			Name:        "roll_dice",
+			Description: "Roll dice in NdM+K notation, e.g. d20, 2d6 or 3d8+2.",
+			Parameters: objectSchema(map[string]interface{}{
+				"dice": map[string]interface{}{"type": "string"},
+			}, "dice"),
+		},
+		run: runRollDice,
+	},
+	config.ToolKnowledge: {
+		function: toolFunction{
+			Name:        "search_knowledge",
+			Description: "Search the server FAQ and rules.",
+			Parameters: objectSchema(map[string]interface{}{
+				"query": map[string]interface{}{"type": "string"},
+			}, "query"),
+		},
+		run: runSearchKnowledge,
+	},
+	config.ToolRecentMessages: {
+		function: toolFunction{
+			Name:        "recent_messages",
+			Description: "The latest messages of the current channel, oldest first.",
+			Parameters: objectSchema(map[string]interface{}{
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": "How many messages, at most 20.",
+				},
+			}),
+		},
+		run: runRecentMessages,
+	},
+}
+
+// enabledTools returns the configured tools by function name. The knowledge
+// tool is left out when there is no knowledge base.
+func (s *Service) enabledTools() map[string]tool {
+	tools := make(map[string]tool, len(s.config.Tools.Enabled))
+	for _, name := range s.config.Tools.Enabled {
+		if name == config.ToolKnowledge && s.knowledge == nil {
+			continue
+		}
+		if t, ok := builtinTools[name]; ok {
+			tools[t.function.Name] = t
+		}
+	}
+	return tools
+}
+
+// completeWithTools runs the reply completion, with images added to the last
+// message, and the tool calls the model asks for until it answers with text or
+// runs out of rounds, in which case tool calls are turned off for the last
+// request. Every request is accounted to origin; the returned completion
+// carries the summed usage and cost.
+func (s *Service) completeWithTools(model string, messages []map[string]string, images []imagePart, origin usageOrigin) (completion, float64, error) {
+	tools := s.enabledTools()
+	definitions := make([]toolDefinition, 0, len(tools))
+	for _, name := range s.config.Tools.Enabled {
+		if t, ok := tools[builtinTools[name].function.Name]; ok {
+			definitions = append(definitions, toolDefinition{Type: "function", Function: t.function})
+		}
+	}
+	maxRounds := s.config.Tools.MaxRounds
+	if maxRounds == 0 {
+		maxRounds = defaultMaxToolRounds
+	}
+
+	request := make([]interface{}, 0, len(messages)+2)
+	for _, m := range messages {
+		request = append(request, m)
+	}
+	if len(images) > 0 {
+		request[len(request)-1] = userMessageWithImages(messages[len(messages)-1]["content"], images)
+	}
+
+	var usage tokenUsage
+	var cost float64
+	for round := 0; ; round++ {
+		body := map[string]interface{}{
+			"model":       model,
+			"messages":    request,
+			"max_tokens":  s.replyMaxTokens(),
+			"temperature": defaultTemperature,
+		}
+		if len(definitions) > 0 {
+			body["tools"] = definitions
+			if round == maxRounds {
+				body["tool_choice"] = "none"
+			}
+		}
+		if s.config.StructuredOutput {
+			body["response_format"] = decisionResponseFormat()
+		}
+
+		c, err := s.sendCompletion(body)
+		if err != nil {
+			return c, cost, err
+		}
+		cost += s.accountUsage(model, origin, c.Usage)
+		usage.PromptTokens += c.Usage.PromptTokens
+		usage.CompletionTokens += c.Usage.CompletionTokens
+		usage.TotalTokens += c.Usage.TotalTokens
+
+		if len(c.ToolCalls) == 0 || len(definitions) == 0 || round == maxRounds {
+			c.ToolCalls = nil
+			c.Usage = usage
+			return c, cost, nil
+		}
+
+		request = append(request, assistantToolCalls{Role: "assistant", Content: c.Content, ToolCalls: c.ToolCalls})
+		for _, call := range c.ToolCalls {
+			request = append(request, map[string]string{
+				"role":         "tool",
+				"tool_call_id": call.ID,
+				"content":      s.runTool(tools, call, origin),
+			})
+		}
+	}
+}
+
+// runTool executes one call; errors are reported to the model as the result.
+func (s *Service) runTool(tools map[string]tool, call toolCall, origin usageOrigin) string {
+	countMetric("tool_calls")
+
+	t, ok := tools[call.Function.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %s", call.Function.Name)
+	}
+	result, err := t.run(s, call.Function.Arguments, origin)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("tool", call.Function.Name).Msg("Tool call failed")
+		return fmt.Sprintf("error: %v", err)
+	}
+	s.logger.Debug().Str("tool", call.Function.Name).Str("arguments", call.Function.Arguments).Str("result", result).Msg("Tool called")
+
+	return result
+}
+
+// decodeArguments reads the JSON arguments of a call; models send "" for
+// calls without arguments.
+func decodeArguments(arguments string, v interface{}) error {
+	if strings.TrimSpace(arguments) == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(arguments), v); err != nil {
+		return fmt.Errorf("can't parse arguments: %w", err)
+	}
+	return nil
+}
+
+func runCurrentTime(_ *Service, arguments string, _ usageOrigin) (string, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if args.Timezone != "" {
+		loc, err := time.LoadLocation(args.Timezone)
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone %s", args.Timezone)
+		}
+		now = now.In(loc)
+	}
+
+	return now.Format("Monday 2006-01-02 15:04 MST"), nil
+}
+
+func runRollDice(_ *Service, arguments string, _ usageOrigin) (string, error) {
+	var args struct {
+		Dice string `json:"dice"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	m := diceNotation.FindStringSubmatch(strings.ToLower(strings.ReplaceAll(args.Dice, " ", "")))
+	if m == nil {
+		return "", fmt.Errorf("can't parse dice %q", args.Dice)
+	}
+	count := 1
+	if m[1] != "" {
+		count, _ = strconv.Atoi(m[1])
+	}
+	sides, _ := strconv.Atoi(m[2])
+	modifier := 0
+	if m[3] != "" {
+		modifier, _ = strconv.Atoi(m[3])
+	}
+	if count < 1 || count > maxDice || sides < 2 || sides > maxDieSides {
+		return "", fmt.Errorf("dice out of range: 1-%d dice with 2-%d sides", maxDice, maxDieSides)
+	}
+
+	rolls := make([]string, count)
+	total := modifier
+	for i := range rolls {
+		roll := rand.Intn(sides) + 1
+		total += roll
+		rolls[i] = strconv.Itoa(roll)
+	}
+
+	return fmt.Sprintf("%s: [%s] %+d = %d", args.Dice, strings.Join(rolls, ", "), modifier, total), nil
+}
+
+func runSearchKnowledge(s *Service, arguments string, _ usageOrigin) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	passages := s.findKnowledge(args.Query)
+	if len(passages) == 0 {
+		return "nothing found", nil
+	}
+	return knowledgeMessage(passages)["content"], nil
+}
+
+func runRecentMessages(s *Service, arguments string, origin usageOrigin) (string, error) {
+	args := struct {
+		Limit int `json:"limit"`
+	}{Limit: 10}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	if args.Limit < 1 || args.Limit > 20 {
+		args.Limit = 20
+	}
+
+	recent := s.recentMessages[origin.Channel]
+	if len(recent) > args.Limit {
+		recent = recent[len(recent)-args.Limit:]
+	}
+	if len(recent) == 0 {
+		return "no messages", nil
+	}
+
+	var b strings.Builder
+	for _, msg := range recent {
+		fmt.Fprintf(&b, "%s: %s\n", msg.Author, msg.Content)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// rememberRecent keeps the latest messages of each channel for the
+// recent_messages tool.
+func (s *Service) rememberRecent(channel string, msg chatMessage) {
+	recent := s.recentMessages[channel]
+	for i, m := range recent {
+		if m.ID == msg.ID {
+			// An edited message keeps its place.
+			recent[i] = msg
+			return
+		}
+	}
+	recent = append(recent, msg)
+	if len(recent) > maxRecentMessages {
+		recent = recent[len(recent)-maxRecentMessages:]
+	}
+	s.recentMessages[channel] = recent
+}
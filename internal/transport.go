@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+const (
+	// defaultMaxMessageLength is Discord's limit without Nitro.
+	defaultMaxMessageLength = 2000
+	defaultChunkGapMin      = 2 * time.Second
+	defaultChunkGapMax      = 5 * time.Second
+)
+
+// sentencePattern matches a sentence with the whitespace after it. A line
+// break always ends a sentence.
+var sentencePattern = regexp.MustCompile(`(?s)[^\n]*?(?:[.!?…]+(?:\s+|$)|\n+|$)`)
+
+// messageElement finds a message element by its data-list-item-id.
+func (s *Service) messageElement(id string) (playwright.ElementHandle, error) {
+	element, err := s.page.QuerySelector(fmt.Sprintf("%s[data-list-item-id=%q]", s.selectors.Message, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find message %s: %w", id, err)
+	}
+	if element == nil {
+		return nil, fmt.Errorf("message %s not found", id)
+	}
+	return element, nil
+}
+
+// startReply opens Discord's reply bar for message id: it hovers the message,
+// clicks Reply in its toolbar and sets the mention ping toggle as configured.
+func (s *Service) startReply(id string) (err error) {
+	element, err := s.messageElement(id)
+	if err != nil {
+		return err
+	}
+	if err := element.Hover(); err != nil {
+		return fmt.Errorf("failed to hover message: %w", err)
+	}
+
+	button, err := element.QuerySelector(s.selectors.ReplyButton)
+	if err != nil {
+		s.captureFailure(element, "reply button", s.selectors.ReplyButton)
+		return fmt.Errorf("failed to find reply button: %w", err)
+	}
+	if button == nil {
+		s.captureFailure(element, "reply button", s.selectors.ReplyButton)
+		return fmt.Errorf("reply button not found")
+	}
+	if err := button.Click(); err != nil {
+		return fmt.Errorf("failed to click reply button: %w", err)
+	}
+	// Don't leave the reply bar open when the reply can't be set up, the
+	// caller falls back to a plain message.
+	defer func() {
+		if err == nil {
+			return
+		}
+		if escErr := s.page.Keyboard().Press("Escape"); escErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close reply bar: %w", escErr))
+		}
+	}()
+
+	// The toggle is missing when the bot replies to itself; Discord never
+	// pings then, so there is nothing to set.
+	toggle, err := s.page.QuerySelector(s.selectors.ReplyPing)
+	if err != nil {
+		return fmt.Errorf("failed to find reply ping toggle: %w", err)
+	}
+	if toggle == nil {
+		return nil
+	}
+	checked, err := toggle.GetAttribute("aria-checked")
+	if err != nil {
+		return fmt.Errorf("failed to read reply ping toggle: %w", err)
+	}
+	if (checked == "true") != s.config.ReplyPing {
+		if err := toggle.Click(); err != nil {
+			return fmt.Errorf("failed to switch reply ping: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// cancelReply clears the textbox and closes the reply bar so a plain message
+// can be sent instead.
+func (s *Service) cancelReply(inputBox playwright.ElementHandle) error {
+	for _, key := range []string{"Control+A", "Backspace", "Escape"} {
+		if err := inputBox.Press(key); err != nil {
+			return fmt.Errorf("failed to cancel reply: %w", err)
+		}
+	}
+	return nil
+}
+
+// typeAndSend types text into the textbox and sends it, split into chunks of
+// at most maxMessageLength with a random gap between them. It returns how
+// many chunks were sent.
+func (s *Service) typeAndSend(inputBox playwright.ElementHandle, text string, typing time.Duration) (int, error) {
+	chunks := splitMessage(text, s.maxMessageLength())
+	for i, chunk := range chunks {
+		if i > 0 {
+			time.Sleep(s.chunkGap())
+		}
+
+		if err := inputBox.Click(); err != nil {
+			return i, fmt.Errorf("failed to click on text input box: %w", err)
+		}
+		if err := s.typeLines(inputBox, chunk, typing); err != nil {
+			return i, err
+		}
+		if err := inputBox.Press("Enter"); err != nil {
+			return i, fmt.Errorf("failed to send message: %w", err)
+		}
+	}
+
+	return len(chunks), nil
+}
+
+// typeLines types text with Shift+Enter between lines; a plain Enter would
+// send the message after the first line.
+func (s *Service) typeLines(inputBox playwright.ElementHandle, text string, typing time.Duration) error {
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			if err := inputBox.Press("Shift+Enter"); err != nil {
+				return fmt.Errorf("failed to insert line break: %w", err)
+			}
+		}
+		if line == "" {
+			continue
+		}
+		if err := inputBox.Type(line, playwright.ElementHandleTypeOptions{
+			Delay: playwright.Float(s.typingDelay(typing)),
+		}); err != nil {
+			return fmt.Errorf("failed to type message: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) maxMessageLength() int {
+	if s.config.MaxMessageLength > 0 {
+		return s.config.MaxMessageLength
+	}
+	return defaultMaxMessageLength
+}
+
+func (s *Service) chunkGap() time.Duration {
+	minGap, maxGap := s.config.ChunkGapMin, s.config.ChunkGapMax
+	if maxGap == 0 {
+		minGap, maxGap = defaultChunkGapMin, defaultChunkGapMax
+	}
+	return time.Duration(rand.Int63n(int64(maxGap-minGap+1))) + minGap
+}
+
+// splitMessage splits text into chunks of at most limit characters, on
+// sentence boundaries where possible, then on spaces.
+func splitMessage(text string, limit int) []string {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+	}
+
+	for _, sentence := range sentencePattern.FindAllString(text, -1) {
+		if utf8.RuneCountInString(current.String())+utf8.RuneCountInString(strings.TrimSpace(sentence)) > limit {
+			flush()
+		}
+		for utf8.RuneCountInString(strings.TrimSpace(sentence)) > limit {
+			head, rest := cutAtSpace(sentence, limit)
+			current.WriteString(head)
+			flush()
+			sentence = rest
+		}
+		current.WriteString(sentence)
+	}
+	flush()
+
+	return chunks
+}
+
+// cutAtSpace cuts s after at most limit characters, at the last space of the
+// second half when there is one.
+func cutAtSpace(s string, limit int) (string, string) {
+	runes := []rune(s)
+	cut := limit
+	for i := limit; i > limit/2; i-- {
+		if runes[i] == ' ' {
+			cut = i
+			break
+		}
+	}
+	return string(runes[:cut]), string(runes[cut:])
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func withoutSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func TestSplitMessage(t *testing.T) {
+	const limit = defaultMaxMessageLength
+	sentence := "Ты опять пишешь какую то ерунду и никому это не интересно. "
+
+	tests := []struct {
+		name   string
+		text   string
+		chunks int
+		// end is what every chunk ends with when splits fall on sentences.
+		end string
+	}{
+		{"short", "привет", 1, ""},
+		{"exactly the limit", strings.Repeat("я", limit), 1, ""},
+		{"cyrillic sentences", strings.Repeat(sentence, 80), 3, "интересно."},
+		{"sentence over the limit", strings.Repeat("слово ", 700), 3, "слово"},
+		{"word over the limit", strings.Repeat("ы", 2*limit+10), 3, ""},
+		{"leading spaces", "    " + strings.Repeat(sentence, 40), 2, "интересно."},
+		{"newline breaks", strings.Repeat("строка без точки\n", 300), 3, "точки"},
+		{"spaces before a long sentence", strings.Repeat(sentence, 30) + "   " + strings.Repeat("ещё ", 600), 3, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitMessage(tt.text, limit)
+			if len(chunks) != tt.chunks {
+				t.Errorf("got %d chunks, want %d", len(chunks), tt.chunks)
+			}
+			for i, chunk := range chunks {
+				if n := utf8.RuneCountInString(chunk); n > limit || n == 0 {
+					t.Errorf("chunk %d is %d characters, limit %d", i, n, limit)
+				}
+				if chunk != strings.TrimSpace(chunk) {
+					t.Errorf("chunk %d has surrounding whitespace", i)
+				}
+				if !strings.HasSuffix(chunk, tt.end) {
+					t.Errorf("chunk %d does not end with %q", i, tt.end)
+				}
+			}
+			// Only the whitespace at chunk boundaries may be lost.
+			if got, want := withoutSpace(strings.Join(chunks, "")), withoutSpace(tt.text); got != want {
+				t.Errorf("chunks don't rebuild the text")
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shushard/ChatBot/internal/config"
+)
+
+const dmChannelMarker = "/channels/@me/"
+
+// triggerInput is everything a rule can look at.
+type triggerInput struct {
+	msg         chatMessage
+	channel     string
+	botUsername string
+	now         time.Time
+}
+
+func (in triggerInput) isDM() bool {
+	return strings.Contains(in.channel, dmChannelMarker)
+}
+
+type triggerRule struct {
+	config.TriggerRule
+	pattern *regexp.Regexp
+}
+
+// triggerEngine evaluates the configured trigger rules and keeps the state
+// they need: rule cooldowns and the time of the bot's last message, both per
+// channel.
+type triggerEngine struct {
+	mu       sync.Mutex
+	rules    []triggerRule
+	lastFire map[string]time.Time
+	lastBot  map[string]time.Time
+	random   func() float64
+}
+
+func newTriggerEngine(rules []config.TriggerRule) (*triggerEngine, error) {
+	if len(rules) == 0 {
+		rules = config.DefaultTriggers()
+	}
+
+	compiled := make([]triggerRule, 0, len(rules))
+	for _, rule := range rules {
+		r := triggerRule{TriggerRule: rule}
+		if rule.Kind == config.TriggerRegex {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("trigger %s: can't compile pattern: %w", rule.Name, err)
+			}
+			r.pattern = pattern
+		}
+		compiled = append(compiled, r)
+	}
+	sort.SliceStable(compiled, func(i, j int) bool {
+		return compiled[i].Priority > compiled[j].Priority
+	})
+
+	return &triggerEngine{
+		rules:    compiled,
+		lastFire: make(map[string]time.Time),
+		lastBot:  make(map[string]time.Time),
+		random:   rand.Float64,
+	}, nil
+}
+
+// botPosted records that the bot wrote in channel, for follow-up rules.
+func (e *triggerEngine) botPosted(channel string, at time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lastBot[channel] = at
+}
+
+// match returns the rule that makes the bot answer, or false when no rule
+// matched or an exclusion did.
+func (e *triggerEngine) match(in triggerInput) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, rule := range e.rules {
+		if !e.matches(rule, in) {
+			continue
+		}
+		if rule.Exclude {
+			return rule.Name, false
+		}
+		// Cooldowns are per channel, a rule firing in one channel doesn't
+		// silence it in the others.
+		key := rule.Name + " " + in.channel
+		if last, ok := e.lastFire[key]; ok && rule.Cooldown > 0 && in.now.Sub(last) < rule.Cooldown {
+			continue
+		}
+		e.lastFire[key] = in.now
+		return rule.Name, true
+	}
+
+	return "", false
+}
+
+func (e *triggerEngine) matches(rule triggerRule, in triggerInput) bool {
+	if len(rule.Channels) > 0 && !hasAnyPrefix(in.channel, rule.Channels) {
+		return false
+	}
+	if len(rule.Authors) > 0 && !containsFold(rule.Authors, in.msg.Author) {
+		return false
+	}
+
+	switch rule.Kind {
+	case config.TriggerMention:
+		return in.msg.mentions(in.botUsername)
+	case config.TriggerReply:
+		return strings.EqualFold(in.msg.ReplyAuthor, in.botUsername)
+	case config.TriggerKeyword:
+		content := strings.ToLower(in.msg.Content)
+		for _, keyword := range rule.Keywords {
+			if strings.Contains(content, strings.ToLower(keyword)) {
+				return true
+			}
+		}
+		return false
+	case config.TriggerRegex:
+		return rule.pattern.MatchString(in.msg.Content)
+	case config.TriggerDM:
+		return in.isDM()
+	case config.TriggerFollowUp:
+		last, ok := e.lastBot[in.channel]
+		return ok && in.now.Sub(last) <= rule.Within
+	case config.TriggerRandom:
+		return e.random() < rule.Probability
+	}
+
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(normalizeName(item), s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultMaxImages     = 4
+	defaultMaxImageBytes = 5 << 20
+	// imagePromptTokens is what one low-detail image costs in the prompt.
+	imagePromptTokens = 85
+	imageMarker       = "[картинка]"
+)
+
+var defaultImageTypes = []string{"image/png", "image/jpeg", "image/webp", "image/gif"}
+
+// imagePart is a downloaded image for the model.
+type imagePart struct {
+	MIME string
+	Data []byte
+}
+
+func (i imagePart) dataURL() string {
+	return "data:" + i.MIME + ";base64," + base64.StdEncoding.EncodeToString(i.Data)
+}
+
+type imageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail"`
+}
+
+type contentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *imageURL `json:"image_url,omitempty"`
+}
+
+// multipartMessage is a chat message with text and image parts.
+type multipartMessage struct {
+	Role    string        `json:"role"`
+	Content []contentPart `json:"content"`
+}
+
+func userMessageWithImages(text string, images []imagePart) multipartMessage {
+	m := multipartMessage{Role: "user"}
+	if text != "" {
+		m.Content = append(m.Content, contentPart{Type: "text", Text: text})
+	}
+	for _, image := range images {
+		m.Content = append(m.Content, contentPart{
+			Type:     "image_url",
+			ImageURL: &imageURL{URL: image.dataURL(), Detail: "low"},
+		})
+	}
+	return m
+}
+
+// withImageMarker is the history text of a message that had images.
+func withImageMarker(text string, images []imagePart) string {
+	if len(images) == 0 {
+		return text
+	}
+	return strings.TrimSpace(text + " " + strings.Repeat(imageMarker, len(images)))
+}
+
+// downloadImages fetches message images through the browser context, so
+// Discord cookies apply. Images over the size limit, of other types or past
+// the count limit are skipped.
+func (s *Service) downloadImages(urls []string) []imagePart {
+	if !s.config.Vision.Enabled || len(urls) == 0 {
+		return nil
+	}
+	maxImages := s.config.Vision.MaxImages
+	if maxImages == 0 {
+		maxImages = defaultMaxImages
+	}
+	if len(urls) > maxImages {
+		countMetric("images_skipped")
+		urls = urls[:maxImages]
+	}
+
+	var images []imagePart
+	for _, url := range urls {
+		image, err := s.downloadImage(url)
+		if err != nil {
+			countMetric("images_skipped")
+			s.logger.Warn().Err(err).Str("url", url).Msg("Skipping image")
+			continue
+		}
+		images = append(images, image)
+	}
+
+	return images
+}
+
+func (s *Service) downloadImage(url string) (imagePart, error) {
+	resp, err := s.page.Request().Get(url)
+	if err != nil {
+		return imagePart{}, fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Dispose()
+
+	if !resp.Ok() {
+		return imagePart{}, fmt.Errorf("failed to download image: %s", resp.StatusText())
+	}
+
+	mimeType, _, err := mime.ParseMediaType(resp.Headers()["content-type"])
+	if err != nil {
+		return imagePart{}, fmt.Errorf("can't parse image type: %w", err)
+	}
+	if !s.imageTypeAllowed(mimeType) {
+		return imagePart{}, fmt.Errorf("image type %s is not allowed", mimeType)
+	}
+
+	maxBytes := s.config.Vision.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = defaultMaxImageBytes
+	}
+	// Reject what announces its size before reading the body; the size is
+	// checked again for responses without content-length.
+	if length, err := strconv.ParseInt(resp.Headers()["content-length"], 10, 64); err == nil && length > maxBytes {
+		return imagePart{}, fmt.Errorf("image is %d bytes, over the %d limit", length, maxBytes)
+	}
+
+	body, err := resp.Body()
+	if err != nil {
+		return imagePart{}, fmt.Errorf("failed to read image: %w", err)
+	}
+	if int64(len(body)) > maxBytes {
+		return imagePart{}, fmt.Errorf("image is %d bytes, over the %d limit", len(body), maxBytes)
+	}
+
+	return imagePart{MIME: mimeType, Data: body}, nil
+}
+
+func (s *Service) imageTypeAllowed(mimeType string) bool {
+	types := s.config.Vision.Types
+	if len(types) == 0 {
+		types = defaultImageTypes
+	}
+	for _, t := range types {
+		if strings.EqualFold(t, mimeType) {
+			return true
+		}
+	}
+	return false
+}